@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Writes the entries of an archive. Names use forward slashes and directories
+// are added before their contents.
+type archiveWriter interface {
+	addDir(name string, modTime time.Time) error
+	addLink(name string, target string, modTime time.Time) error
+	addFile(name string, size int64, modTime time.Time, contents io.Reader) error
+	Close() error
+}
+
+// Figure out the archive format from the format option or the file name
+func archiveFormat(format string, fileName string) (string, error) {
+	switch format {
+	case "tar", "tar.gz", "zip":
+		return format, nil
+	case "tgz":
+		return "tar.gz", nil
+	case "":
+	default:
+		return "", simpleWarning("Unknown archive format '" + format + "'. Use tar, tar.gz or zip.")
+	}
+
+	lower := strings.ToLower(fileName)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"), fileName == "", fileName == "-":
+		return "tar.gz", nil
+	}
+
+	return "", simpleWarning("Can't tell the archive format from the file name " + fileName + ". Use the -format option.")
+}
+
+func newArchiveWriter(format string, out io.Writer) archiveWriter {
+	switch format {
+	case "zip":
+		return &zipArchive{zw: zip.NewWriter(out)}
+	case "tar.gz":
+		gz := gzip.NewWriter(out)
+		return &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+	}
+
+	return &tarArchive{tw: tar.NewWriter(out)}
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) addDir(name string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime})
+}
+
+func (a *tarArchive) addLink(name string, target string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777, ModTime: modTime})
+}
+
+func (a *tarArchive) addFile(name string, size int64, modTime time.Time, contents io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Size: size, Mode: 0644, ModTime: modTime})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.tw, contents)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	err := a.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+
+	return nil
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) create(name string, mode os.FileMode, method uint16, modTime time.Time) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: method}
+	header.SetModTime(modTime)
+	header.SetMode(mode)
+
+	return a.zw.CreateHeader(header)
+}
+
+func (a *zipArchive) addDir(name string, modTime time.Time) error {
+	_, err := a.create(name+"/", os.ModeDir|0755, zip.Store, modTime)
+	return err
+}
+
+// Links are stored the way zip tools on unix store them, with the target as the contents
+func (a *zipArchive) addLink(name string, target string, modTime time.Time) error {
+	w, err := a.create(name, os.ModeSymlink|0777, zip.Store, modTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte(target))
+	return err
+}
+
+func (a *zipArchive) addFile(name string, size int64, modTime time.Time, contents io.Reader) error {
+	w, err := a.create(name, 0644, zip.Deflate, modTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, contents)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"container/list"
+	"flag"
 	"fmt"
 	"gopkg.in/fsnotify.v1"
 	"os"
@@ -22,7 +23,7 @@ func listenForRepoWorkspaceChanges(client *Client, sandboxPath string, workspace
 		}
 
 		// Poll for remote changes
-		fmt.Println("Polling ", metadata.workspaceId)
+		emitMessage("Polling %v", metadata.workspaceId)
 		hasChanges := pollForRepoWorkspaceChanges(client, metadata)
 		if hasChanges {
 			workspaceChangeChan <- true
@@ -50,7 +51,7 @@ func pollForRepoWorkspaceChanges(client *Client, md *metaData) bool {
 
 // Run our sync op
 func runSync(watcher *fsnotify.Watcher, toUpdate *map[string]bool, sandboxPath string, client *Client) {
-	fmt.Println("Running sync...")
+	emit(Event{Type: EVENT_PHASE_STARTED, Phase: "sync", Path: sandboxPath, Message: "Running sync..."})
 	paths := make([]string, len(*toUpdate))
 	i := 0
 	for key := range *toUpdate {
@@ -63,14 +64,15 @@ func runSync(watcher *fsnotify.Watcher, toUpdate *map[string]bool, sandboxPath s
 		panic(err)
 	}
 
-	doSyncOp(client, sandboxPath, status, false)
-	fmt.Println("Sync complete")
+	doSyncOp(client, sandboxPath, status, false, "")
+	emit(Event{Type: EVENT_PHASE_FINISHED, Phase: "sync", Path: sandboxPath, Message: "Sync complete"})
 
 	*toUpdate = make(map[string]bool)
 }
 
-// Add the directories under the given
+// Add the directories under the given root, except for the ignored ones
 func subscribeTree(watcher *fsnotify.Watcher, root string) {
+	ignores := newIgnorer(root)
 	subscriptionList := list.New() // The directories we have yet to subscribe to
 	subscriptionList.PushFront(root)
 
@@ -94,7 +96,13 @@ func subscribeTree(watcher *fsnotify.Watcher, root string) {
 		for _, child := range infos {
 			if child.IsDir() {
 				path := filepath.Join(cur, child.Name())
-				subscriptionList.PushFront(path)
+				ignored, err := ignores.ignored(path)
+				if err != nil {
+					panic(err)
+				}
+				if !ignored {
+					subscriptionList.PushFront(path)
+				}
 			}
 		}
 
@@ -103,7 +111,7 @@ func subscribeTree(watcher *fsnotify.Watcher, root string) {
 }
 
 // Updates our Watcher with newly created directories.
-func adjustWatchSet(watcher *fsnotify.Watcher, event fsnotify.Event, sandbox Path) {
+func adjustWatchSet(watcher *fsnotify.Watcher, event fsnotify.Event, sandbox Path, ignores *ignorer) {
 	// Update our watcher to watch new directories and ignore deleted directories
 	if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Remove == fsnotify.Remove {
 
@@ -112,7 +120,7 @@ func adjustWatchSet(watcher *fsnotify.Watcher, event fsnotify.Event, sandbox Pat
 		eventPath := pathToArray(event.Name)
 		if sandbox.isPrefixOf(eventPath) {
 			if len(eventPath) > len(sandbox) && strings.HasPrefix(eventPath[len(sandbox)], ".jazz") {
-				fmt.Println("Skipping event \"", event.Name, "\" due to .jazz prefix")
+				emitMessage("Skipping event \"%v\" due to .jazz prefix", event.Name)
 				return
 			}
 		}
@@ -120,23 +128,36 @@ func adjustWatchSet(watcher *fsnotify.Watcher, event fsnotify.Event, sandbox Pat
 		// If we create a new directory, we need to track its contents as well
 		stat, err := os.Lstat(event.Name)
 		if err != nil {
-			fmt.Println("Failed to stat: ", event.Name)
+			emitWarning("Failed to stat: %v", event.Name)
 			return
 		}
 
 		if stat.IsDir() {
 			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				fmt.Println("Incremental directory remove ", event.Name)
+				emitMessage("Incremental directory remove %v", event.Name)
 				watcher.Remove(event.Name)
 			} else if event.Op&fsnotify.Create == fsnotify.Create {
-				fmt.Println("Incremental directory add ", event.Name)
+				if ignored, _ := ignores.ignored(event.Name); ignored {
+					return
+				}
+				emitMessage("Incremental directory add %v", event.Name)
 				watcher.Add(event.Name)
 			}
 		}
 	}
 }
 
+func autosyncDefaults() {
+	fmt.Printf("gojazz autosync [options]\n")
+	flag.PrintDefaults()
+}
+
 func autosyncOp() {
+	transfer := transferFlags()
+	flag.Usage = autosyncDefaults
+	flag.Parse()
+	transfer.apply()
+
 	// Sanity check: are we running in a sandbox?
 	path, err := os.Getwd()
 	if err != nil {
@@ -147,6 +168,12 @@ func autosyncOp() {
 		panic(simpleWarning("Autosync must run in a sandbox. Use 'gojazz load' to get your content onto disk and create a sandbox."))
 	}
 
+	metadata := newMetaData()
+	err = metadata.load(filepath.Join(path, metadataFileName))
+	if err == nil && (metadata.isstream || metadata.readonly) {
+		panic(simpleWarning("Autosync is for your own repository workspaces, use load instead to incrementally update your sandbox."))
+	}
+
 	sandbox := pathToArray(path)
 
 	// We're in a sandbox. Start our client
@@ -181,8 +208,13 @@ func autosyncOp() {
 		for {
 			select {
 			case event := <-watcher.Events:
-				adjustWatchSet(watcher, event, sandbox)
-				if trackEventsForSync {
+				// The ignore files may change while we are running
+				ignores := newIgnorer(path)
+				adjustWatchSet(watcher, event, sandbox, ignores)
+
+				// Changes to ignored files don't need a sync
+				ignored, _ := ignores.ignored(event.Name)
+				if trackEventsForSync && !ignored {
 					fsEventChan <- event
 				}
 
@@ -209,7 +241,7 @@ func autosyncOp() {
 
 			case <-syncTimer.C:
 				// Our accumulation timer has elapsed, sync
-				fmt.Println("Committing local changes to repository")
+				emitMessage("Committing local changes to repository")
 
 				fsListenerControlChan <- false
 				runSync(watcher, &toUpdate, path, client)
@@ -224,7 +256,7 @@ func autosyncOp() {
 				fsListenerControlChan <- true
 
 			case err := <-watcher.Errors:
-				fmt.Println("error:", err)
+				emitWarning("error: %v", err)
 			}
 		}
 	}()
@@ -234,5 +266,5 @@ func autosyncOp() {
 	go listenForRepoWorkspaceChanges(client, path, workspaceChangeChan)
 
 	doneChan := make(chan bool)
-	fmt.Println(<-doneChan)
+	<-doneChan
 }
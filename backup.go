@@ -0,0 +1,504 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Local changes that an operation would overwrite are copied into a new backup
+// set under the backup folder of the sandbox first. Each set keeps the changed
+// files, a manifest with the changes and a copy of the metadata of the sandbox
+// as it was before the operation.
+const (
+	backupManifestName = "backup.json"
+	backupMetadataName = "metadata"
+	backupFilesFolder  = "files"
+	backupIdFormat     = "20060102-150405"
+
+	// Sets are removed once there are newer ones to spare and they are old
+	defaultBackupKeep = 10
+	defaultBackupDays = 30
+)
+
+type backupManifest struct {
+	Id          string        `json:"id"`
+	Created     time.Time     `json:"created"`
+	Operation   string        `json:"operation"`
+	Sandbox     string        `json:"sandbox"`
+	WorkspaceId string        `json:"workspaceId"`
+	Type        string        `json:"type"`
+	Changes     []statusEntry `json:"changes"`
+
+	dir string
+}
+
+type byBackupCreated []backupManifest
+
+func (a byBackupCreated) Len() int      { return len(a) }
+func (a byBackupCreated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byBackupCreated) Less(i, j int) bool {
+	if a[i].Created.Equal(a[j].Created) {
+		return a[i].Id < a[j].Id
+	}
+	return a[i].Created.Before(a[j].Created)
+}
+
+// A new backup set ID from the time that isn't taken in the sandbox yet
+func newBackupId(sandboxPath string, created time.Time) string {
+	base := created.Format(backupIdFormat)
+
+	id := base
+	for i := 2; ; i++ {
+		_, err := os.Lstat(filepath.Join(sandboxPath, backupFolder, id))
+		if os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%v-%v", base, i)
+	}
+}
+
+func isBackupId(name string) bool {
+	if len(name) < len(backupIdFormat) {
+		return false
+	}
+
+	_, err := time.Parse(backupIdFormat, name[:len(backupIdFormat)])
+	return err == nil
+}
+
+// Finish the backup set that the status copied the changed files into. The
+// manifest names the operation that made the backup.
+func (status *status) saveBackup(operation string) (*backupManifest, error) {
+	dir := filepath.Dir(status.copyPath)
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := ioutil.ReadFile(filepath.Join(status.sandboxPath, metadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, backupMetadataName), metadata, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &backupManifest{
+		Id:          filepath.Base(dir),
+		Created:     time.Now(),
+		Operation:   operation,
+		Sandbox:     status.sandboxPath,
+		WorkspaceId: status.metaData.workspaceId,
+		Type:        status.typeName(),
+		Changes:     status.entries(),
+		dir:         dir,
+	}
+
+	return manifest, manifest.write()
+}
+
+func (manifest *backupManifest) write() error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(manifest.dir, backupManifestName), b, 0600)
+}
+
+// The backup sets of the sandbox from the oldest to the newest
+func listBackups(sandboxPath string) ([]backupManifest, error) {
+	err := migrateLegacyBackup(sandboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(filepath.Join(sandboxPath, backupFolder))
+	if os.IsNotExist(err) {
+		return []backupManifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	backups := []backupManifest{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		manifest, err := readBackup(sandboxPath, info.Name())
+		if err != nil {
+			// Sets of loads that were interrupted have no manifest
+			continue
+		}
+		backups = append(backups, *manifest)
+	}
+
+	sort.Sort(byBackupCreated(backups))
+
+	return backups, nil
+}
+
+func readBackup(sandboxPath string, id string) (*backupManifest, error) {
+	dir := filepath.Join(sandboxPath, backupFolder, id)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &backupManifest{}
+	err = json.Unmarshal(b, manifest)
+	if err != nil {
+		return nil, err
+	}
+	manifest.dir = dir
+
+	return manifest, nil
+}
+
+// Older versions copied the changes straight into the backup folder, each load
+// on top of the last one. They become a backup set of their own.
+func migrateLegacyBackup(sandboxPath string) error {
+	backupPath := filepath.Join(sandboxPath, backupFolder)
+
+	infos, err := ioutil.ReadDir(backupPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	legacy := []os.FileInfo{}
+	for _, info := range infos {
+		_, err := os.Stat(filepath.Join(backupPath, info.Name(), backupManifestName))
+		if err == nil {
+			continue
+		}
+
+		// Sets that are being written have their files folder already
+		if isBackupId(info.Name()) {
+			_, err = os.Stat(filepath.Join(backupPath, info.Name(), backupFilesFolder))
+			if err == nil {
+				continue
+			}
+		}
+
+		legacy = append(legacy, info)
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	// The files were backed up by the last load that found changes
+	created := time.Time{}
+	for _, info := range legacy {
+		if info.ModTime().After(created) {
+			created = info.ModTime()
+		}
+	}
+
+	manifest := &backupManifest{Created: created, Operation: "load", Sandbox: sandboxPath, Changes: []statusEntry{}}
+	manifest.Id = newBackupId(sandboxPath, created)
+	manifest.dir = filepath.Join(backupPath, manifest.Id)
+
+	filesPath := filepath.Join(manifest.dir, backupFilesFolder)
+	err = os.MkdirAll(filesPath, 0700)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range legacy {
+		err = os.Rename(filepath.Join(backupPath, info.Name()), filepath.Join(filesPath, info.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The changes weren't recorded, only the files are known
+	err = filepath.Walk(filesPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == filesPath {
+			return err
+		}
+
+		rel, err := filepath.Rel(filesPath, path)
+		if err != nil {
+			return err
+		}
+		entry := statusEntry{Path: filepath.ToSlash(rel), Change: "Backed up"}
+		if !info.IsDir() {
+			entry.Size = info.Size()
+		}
+		manifest.Changes = append(manifest.Changes, entry)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return manifest.write()
+}
+
+// Remove the backup sets beyond the newest ones to keep that are older than the
+// number of days. Returns the number of sets that were removed.
+func pruneBackups(sandboxPath string, keep int, days int) (int, error) {
+	backups, err := listBackups(sandboxPath)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := time.Now().AddDate(0, 0, -days)
+	for i := 0; i < len(backups)-keep; i++ {
+		if backups[i].Created.After(cutoff) {
+			continue
+		}
+
+		err = os.RemoveAll(backups[i].dir)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func backupDefaults() {
+	fmt.Printf("gojazz backup list [options]\n")
+	fmt.Printf("gojazz backup show [options] <id>\n")
+	fmt.Printf("gojazz backup restore [options] <id> [paths...]\n")
+	fmt.Printf("gojazz backup prune [options]\n")
+	flag.PrintDefaults()
+}
+
+func backupOp() {
+	if len(os.Args) < 2 {
+		backupDefaults()
+		return
+	}
+	command := os.Args[1]
+	os.Args = os.Args[1:]
+
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	dryRun := flag.Bool("dry-run", false, "Only show the files that would be restored")
+	keep := flag.Int("keep", defaultBackupKeep, "Number of the newest backup sets that are never pruned")
+	days := flag.Int("days", defaultBackupDays, "Prune the other backup sets once they are older than this number of days")
+	flag.Usage = backupDefaults
+	flag.Parse()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if *sandboxPath == "" {
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+	if !isSandbox(*sandboxPath) {
+		panic(simpleWarning("Not a sandbox"))
+	}
+
+	switch command {
+	case "list":
+		backups, err := listBackups(*sandboxPath)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, backup := range backups {
+			emitMessage("%v  %v  %v  %v changes", backup.Id, backup.Created.Format("2006-01-02 15:04:05"), backup.Operation, len(backup.Changes))
+		}
+		if len(backups) == 0 {
+			emitMessage("No backups in %v", *sandboxPath)
+		}
+	case "show":
+		if flag.NArg() != 1 {
+			emitWarning("Provide the ID of the backup set to show and try again. Use 'gojazz backup list' to find it.")
+			backupDefaults()
+			return
+		}
+		backup := findBackup(*sandboxPath, flag.Arg(0))
+
+		emitMessage("Backup %v made by %v on %v", backup.Id, backup.Operation, backup.Created.Format("2006-01-02 15:04:05"))
+		for _, entry := range backup.Changes {
+			emit(Event{Type: EVENT_CHANGE, Phase: "backup", Path: entry.Path, From: entry.From, Change: entry.Change})
+		}
+		emit(Event{Type: EVENT_SUMMARY, Phase: "backup", Path: backup.dir, Files: len(backup.Changes)})
+	case "restore":
+		if flag.NArg() == 0 {
+			emitWarning("Provide the ID of the backup set to restore and try again. Use 'gojazz backup list' to find it.")
+			backupDefaults()
+			return
+		}
+		backup := findBackup(*sandboxPath, flag.Arg(0))
+
+		filters := []string{"."}
+		if flag.NArg() > 1 {
+			filters = sandboxPaths(*sandboxPath, cwd, flag.Args()[1:])
+		}
+
+		restoreBackup(*sandboxPath, backup, filters, *dryRun)
+	case "prune":
+		removed, err := pruneBackups(*sandboxPath, *keep, *days)
+		if err != nil {
+			panic(err)
+		}
+
+		emit(Event{Type: EVENT_SUMMARY, Phase: "prune", Path: filepath.Join(*sandboxPath, backupFolder), Files: removed, Message: fmt.Sprintf("Removed %v backup sets", removed)})
+	default:
+		backupDefaults()
+	}
+}
+
+func findBackup(sandboxPath string, id string) *backupManifest {
+	err := migrateLegacyBackup(sandboxPath)
+	if err != nil {
+		panic(err)
+	}
+
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		panic(simpleWarning("Invalid backup ID " + id))
+	}
+
+	backup, err := readBackup(sandboxPath, id)
+	if os.IsNotExist(err) {
+		panic(simpleWarning("There is no backup " + id + " in " + sandboxPath + ". Use 'gojazz backup list' to find it."))
+	} else if err != nil {
+		panic(err)
+	}
+
+	return backup
+}
+
+// Copy the files of the backup set back into the sandbox. Changes that are in
+// the sandbox now are backed up first so that nothing is lost.
+func restoreBackup(sandboxPath string, backup *backupManifest, filters []string, dryRun bool) {
+	filesPath := filepath.Join(backup.dir, backupFilesFolder)
+
+	restore := []string{}
+	err := filepath.Walk(filesPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == filesPath {
+			return nil
+		}
+
+		rel, err := filepath.Rel(filesPath, path)
+		if err != nil {
+			return err
+		}
+		if withinAny(rel, filters) {
+			restore = append(restore, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if !dryRun && len(restore) > 0 {
+		status, err := scmStatus(sandboxPath, BACKUP)
+		if err != nil {
+			panic(err)
+		}
+		if !status.unchanged() {
+			current, err := status.saveBackup("backup restore")
+			if err != nil {
+				panic(err)
+			}
+			emitWarning("Your changes have been backed up to this location: %v", current.dir)
+		}
+	}
+
+	// Walk order has folders before their contents
+	for _, rel := range restore {
+		emit(Event{Type: EVENT_CHANGE, Phase: "restore", Path: filepath.ToSlash(rel), Change: "Restored"})
+		if dryRun {
+			continue
+		}
+
+		err = restoreBackedUp(filepath.Join(filesPath, rel), filepath.Join(sandboxPath, rel))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	message := fmt.Sprintf("Restored %v files and folders from backup %v", len(restore), backup.Id)
+	if dryRun {
+		message = fmt.Sprintf("Would restore %v files and folders from backup %v", len(restore), backup.Id)
+	}
+	emit(Event{Type: EVENT_SUMMARY, Phase: "restore", Path: sandboxPath, Files: len(restore), Message: message})
+}
+
+func restoreBackedUp(backupPath string, localPath string) error {
+	info, err := os.Lstat(backupPath)
+	if err != nil {
+		return err
+	}
+
+	if isSymlink(info) {
+		return copyLink(backupPath, localPath)
+	}
+
+	if info.IsDir() {
+		// Something other than a folder is in the way
+		local, err := os.Lstat(localPath)
+		if err == nil && !local.IsDir() {
+			err = os.Remove(localPath)
+			if err != nil {
+				return err
+			}
+		}
+		return os.MkdirAll(localPath, 0700)
+	}
+
+	err = os.MkdirAll(filepath.Dir(localPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Links and folders in the way are replaced, the file is written in place
+	//  otherwise to keep its permissions
+	local, err := os.Lstat(localPath)
+	if err == nil && (isSymlink(local) || local.IsDir()) {
+		err = os.RemoveAll(localPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	source, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(target, source)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
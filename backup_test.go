@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupSets(t *testing.T) {
+	sandbox, err := ioutil.TempDir("", "gojazz-backup")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	// Files that an older version copied straight into the backup folder
+	legacyPath := filepath.Join(sandbox, backupFolder, "folder", "file.txt")
+	err = os.MkdirAll(filepath.Dir(legacyPath), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(legacyPath, []byte("mine"), 0600)
+	}
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	backups, err := listBackups(sandbox)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(backups) != 1 || len(backups[0].Changes) != 2 {
+		t.Fatalf("Expected the old backup to become a set with two entries: %v", backups)
+	}
+
+	// Old sets are pruned once there are enough newer ones
+	for i := 0; i < 3; i++ {
+		manifest := &backupManifest{Created: time.Now().AddDate(0, 0, i-10), Operation: "load"}
+		manifest.Id = newBackupId(sandbox, manifest.Created)
+		manifest.dir = filepath.Join(sandbox, backupFolder, manifest.Id)
+		err = os.MkdirAll(manifest.dir, 0700)
+		if err == nil {
+			err = manifest.write()
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	removed, err := pruneBackups(sandbox, 2, 5)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected the two oldest sets to be pruned, %v were", removed)
+	}
+
+	removed, err = pruneBackups(sandbox, 1, 30)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if removed != 0 {
+		t.Errorf("Expected recent sets to be kept, %v were pruned", removed)
+	}
+
+	// Restoring replaces what is in the sandbox now
+	backup := findBackup(sandbox, backups[0].Id)
+	localPath := filepath.Join(sandbox, "folder", "file.txt")
+	err = os.MkdirAll(localPath, 0700)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = restoreBackedUp(filepath.Join(backup.dir, backupFilesFolder, "folder", "file.txt"), localPath)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b, err := ioutil.ReadFile(localPath)
+	if err != nil || string(b) != "mine" {
+		t.Errorf("Expected the backed up file to be restored: %v %v", string(b), err)
+	}
+}
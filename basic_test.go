@@ -170,7 +170,7 @@ func TestLoadAndClobberChanges(t *testing.T) {
 	for _, file := range testContentsWithoutIgnoredStuff {
 		file = filepath.FromSlash(file)
 
-		path := filepath.Join(sandbox1, backupFolder, file)
+		path := filepath.Join(latestBackup(t, sandbox1), backupFilesFolder, file)
 		s, _ := os.Stat(path)
 		if s == nil {
 			t.Fatalf("File not found in backup: %v", path)
@@ -510,7 +510,7 @@ func TestWorkspaceLoadAndClobberChanges(t *testing.T) {
 	for _, file := range testContentsWithoutIgnoredStuff {
 		file = filepath.FromSlash(file)
 
-		path := filepath.Join(sandbox1, backupFolder, file)
+		path := filepath.Join(latestBackup(t, sandbox1), backupFilesFolder, file)
 		s, _ := os.Stat(path)
 		if s == nil {
 			t.Fatalf("File not found in backup: %v", path)
@@ -530,6 +530,45 @@ func TestWorkspaceLoadAndClobberChanges(t *testing.T) {
 	}
 }
 
+// The folder of the newest backup set of the sandbox
+func latestBackup(t *testing.T, sandbox string) string {
+	backups, err := listBackups(sandbox)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(backups) == 0 {
+		t.Fatalf("No backups found in %v", sandbox)
+	}
+
+	return backups[len(backups)-1].dir
+}
+
+// Keeps the events of a test instead of printing them
+type capturingRenderer struct {
+	events []Event
+}
+
+func (r *capturingRenderer) render(e Event) {
+	r.events = append(r.events, e)
+}
+
+// Capture the events until the returned function restores the renderer
+func captureEvents() (*capturingRenderer, func()) {
+	rendererMutex.Lock()
+	defer rendererMutex.Unlock()
+
+	previous := renderer
+	captured := &capturingRenderer{}
+	renderer = captured
+
+	return captured, func() {
+		rendererMutex.Lock()
+		defer rendererMutex.Unlock()
+
+		renderer = previous
+	}
+}
+
 func TestLocalChangeDetection(t *testing.T) {
 	projectName := "sirnewton | gojazz-test2"
 	cleanWorkspace(projectName)
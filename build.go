@@ -1092,8 +1092,10 @@ func buildOp() {
 	os.Args = os.Args[:commandIndex]
 
 	sandboxPath := flag.String("sandbox", "", "Location of the sandbox to sync the files")
+	transfer := transferFlags()
 	flag.Usage = buildDefaults
 	flag.Parse()
+	transfer.apply()
 
 	if *sandboxPath == "" {
 		path, err := os.Getwd()
@@ -1135,8 +1137,8 @@ func buildOp() {
 	}
 
 	if status != nil {
-		fmt.Printf("Loading the latest changes into the build sandbox...\n")
-		scmLoad(client, ccmBaseUrl, projectName, status.metaData.workspaceId, status.metaData.isstream, userId, *sandboxPath, status, true)
+		emitMessage("Loading the latest changes into the build sandbox...")
+		scmLoad(client, ccmBaseUrl, projectName, status.metaData.workspaceId, status.metaData.isstream, status.metaData.readonly, userId, *sandboxPath, status, true, nil, nil)
 	}
 
 	// Find the build engine and build definition for the project
@@ -1176,7 +1178,7 @@ func buildOp() {
 	}
 
 	// Start the build
-	fmt.Printf("Starting the build...\n")
+	emitMessage("Starting the build...")
 	buildResultHandle, err := startBuild(client, ccmBaseUrl, buildDefHandle, buildEngineHandle)
 	if err != nil {
 		panic(err)
@@ -1186,7 +1188,7 @@ func buildOp() {
 	buildUrl = url.QueryEscape(buildUrl)
 	buildUrl = strings.Replace(buildUrl, "+", "%20", -1)
 	buildUrl = "https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=" + buildUrl
-	fmt.Printf("Access the build status here:\n%v\n", buildUrl)
+	emit(Event{Type: EVENT_MESSAGE, Message: "Access the build status here:", Url: buildUrl})
 
 	// Update the build result with the build label and whether this is a personal build
 	buildResult, err := fetchFullBuildResult(client, ccmBaseUrl, buildResultHandle)
@@ -1214,8 +1216,12 @@ func buildOp() {
 	}
 
 	// Multiplex the output from the command to the log file and
-	//  standard out/err
-	stdouttee := io.MultiWriter(outputFile, os.Stdout)
+	//  standard out/err. Standard out is kept for the events in JSON.
+	var stdout io.Writer = os.Stdout
+	if jsonOutput() {
+		stdout = os.Stderr
+	}
+	stdouttee := io.MultiWriter(outputFile, stdout)
 	stderrtee := io.MultiWriter(outputFile, os.Stderr)
 
 	cmd.Stdout = stdouttee
@@ -1225,7 +1231,7 @@ func buildOp() {
 
 	buildBeginTime := time.Now()
 
-	fmt.Printf("Running the build command...\n.")
+	emitMessage("Running the build command...")
 	outputFile.Write([]byte(fmt.Sprintf("BEGIN BUILD: %v\n", buildResult.Label)))
 	hostname, err := os.Hostname()
 	if err == nil {
@@ -1238,7 +1244,7 @@ func buildOp() {
 	outputFile.Write([]byte(fmt.Sprintf("%v\n", strings.Join(buildCommands, " "))))
 	err = cmd.Run()
 	if err != nil {
-		fmt.Printf("%v\n", err.Error())
+		emitWarning("%v", err.Error())
 		outputFile.Write([]byte(fmt.Sprintf("%v\n", err.Error())))
 		isError = true
 	}
@@ -1251,7 +1257,7 @@ func buildOp() {
 	}
 
 	// Upload the output log
-	fmt.Printf("Publishing the build log...\n")
+	emitMessage("Publishing the build log...")
 	contentId, contentLength, contentHash, err := uploadFile(client, ccmBaseUrl, outputFile.Name(), "text/plain")
 	if err != nil {
 		panic(err)
@@ -1267,11 +1273,11 @@ func buildOp() {
 	}
 
 	if len(artifacts) > 0 {
-		fmt.Printf("Publishing artifacts for download...\n")
+		emitMessage("Publishing artifacts for download...")
 	}
 
 	for _, artifact := range artifacts {
-		fmt.Printf(" %v\n", artifact)
+		emitMessage(" %v", artifact)
 		contentId, contentLength, contentHash, err = uploadFile(client, ccmBaseUrl, artifact, "application/unknown")
 		if err != nil {
 			panic(err)
@@ -1282,7 +1288,7 @@ func buildOp() {
 		}
 	}
 
-	fmt.Printf("Updating the build status...\n")
+	emitMessage("Updating the build status...")
 	if isError {
 		// Update the build result with the the final status
 		buildResult, err = fetchFullBuildResult(client, ccmBaseUrl, buildResultHandle)
@@ -1303,5 +1309,5 @@ func buildOp() {
 		panic(err)
 	}
 
-	fmt.Printf("Access the build status here:\n%v\n", buildUrl)
+	emit(Event{Type: EVENT_MESSAGE, Message: "Access the build status here:", Url: buildUrl})
 }
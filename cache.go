@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The contents of downloaded files are kept in a cache that is shared by all
+// of the user's sandboxes. Objects are stored under the SHA-1 hash of their
+// contents in the repository and an index maps each item and state ID to its
+// hash. Line delimiters are converted when the contents are placed in a sandbox.
+const (
+	cacheFolder      = "cache"
+	cacheObjects     = "objects"
+	cacheIndex       = "index"
+	cacheTempPrefix  = "download-"
+	defaultCacheSize = "2G"
+)
+
+// The shared cache, nil when it isn't being used
+var objects *objectCache
+
+type objectCache struct {
+	dir     string
+	maxSize int64
+}
+
+func cacheDir() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, gojazzDataDir, cacheFolder), nil
+}
+
+func openObjectCache(maxSize int64) (*objectCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range []string{cacheObjects, cacheIndex} {
+		err = os.MkdirAll(filepath.Join(dir, folder), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &objectCache{dir: dir, maxSize: maxSize}, nil
+}
+
+func (cache *objectCache) indexPath(itemId string, stateId string) string {
+	return filepath.Join(cache.dir, cacheIndex, itemId, stateId)
+}
+
+func (cache *objectCache) objectPath(hash string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", simpleWarning("Missing hash for the cached object")
+	}
+	name := hex.EncodeToString(b)
+
+	return filepath.Join(cache.dir, cacheObjects, name[:2], name), nil
+}
+
+// Find the cached contents of a state of a file
+func (cache *objectCache) lookup(itemId string, stateId string) (string, string, bool) {
+	indexPath := cache.indexPath(itemId, stateId)
+
+	b, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return "", "", false
+	}
+	hash := strings.TrimSpace(string(b))
+
+	objectPath, err := cache.objectPath(hash)
+	if err != nil {
+		os.Remove(indexPath)
+		return "", "", false
+	}
+
+	// The modification time records the last use for the eviction. The object
+	//  may have been evicted already.
+	now := time.Now()
+	err = os.Chtimes(objectPath, now, now)
+	if err != nil {
+		os.Remove(indexPath)
+		return "", "", false
+	}
+
+	return hash, objectPath, true
+}
+
+// Put the cached contents at the local path with the local line delimiters
+// and return the hash of the normalized contents. Contents that don't need a
+// conversion are cloned when the file system supports it. They are never hard
+// linked since editing the file in place would change it for every sandbox.
+func (cache *objectCache) place(objectPath string, hash string, localPath string, eol eolStyle) (string, error) {
+	if eol == EOL_NONE {
+		err := cloneFile(objectPath, localPath)
+		if err == nil {
+			return hash, nil
+		}
+	}
+
+	object, err := os.Open(objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	localFile, err := os.Create(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer localFile.Close()
+
+	normalizedHash := sha1.New()
+	tee := io.TeeReader(normalizeEol(object, eol), normalizedHash)
+	_, err = io.Copy(localFile, localizeEol(tee, eol))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(normalizedHash.Sum(nil)), nil
+}
+
+// Collects the contents of a download, as they are in the repository, for the cache
+type cacheWriter struct {
+	cache *objectCache
+	temp  *os.File
+}
+
+func (cache *objectCache) newWriter() (*cacheWriter, error) {
+	temp, err := ioutil.TempFile(filepath.Join(cache.dir, cacheObjects), cacheTempPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheWriter{cache: cache, temp: temp}, nil
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	return w.temp.Write(p)
+}
+
+// Keep the downloaded contents under their hash and remember the hash for the state
+func (w *cacheWriter) commit(itemId string, stateId string, hash string) error {
+	err := w.temp.Close()
+	if err != nil {
+		os.Remove(w.temp.Name())
+		return err
+	}
+
+	objectPath, err := w.cache.objectPath(hash)
+	if err != nil {
+		os.Remove(w.temp.Name())
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(objectPath), 0700)
+	if err != nil {
+		os.Remove(w.temp.Name())
+		return err
+	}
+
+	// Another sandbox may have stored the same contents in the meantime
+	err = os.Rename(w.temp.Name(), objectPath)
+	if err != nil {
+		os.Remove(w.temp.Name())
+		if _, statErr := os.Stat(objectPath); statErr != nil {
+			return err
+		}
+	}
+
+	return w.cache.putIndex(itemId, stateId, hash)
+}
+
+func (w *cacheWriter) abort() {
+	w.temp.Close()
+	os.Remove(w.temp.Name())
+}
+
+func (cache *objectCache) putIndex(itemId string, stateId string, hash string) error {
+	indexPath := cache.indexPath(itemId, stateId)
+
+	err := os.MkdirAll(filepath.Dir(indexPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(indexPath), cacheTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write([]byte(hash))
+	temp.Close()
+	if err == nil {
+		err = os.Rename(temp.Name(), indexPath)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+
+	return err
+}
+
+type cachedObject struct {
+	path    string
+	size    int64
+	lastUse time.Time
+}
+
+type byLastUse []cachedObject
+
+func (a byLastUse) Len() int           { return len(a) }
+func (a byLastUse) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLastUse) Less(i, j int) bool { return a[i].lastUse.Before(a[j].lastUse) }
+
+// Evict the least recently used objects until the cache fits in maxSize
+// bytes. Index entries of the evicted objects are removed along with them.
+func (cache *objectCache) prune(maxSize int64) (int, int64, error) {
+	cached := []cachedObject{}
+	total := int64(0)
+
+	err := filepath.Walk(filepath.Join(cache.dir, cacheObjects), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		// Leftovers from downloads that were interrupted
+		if strings.HasPrefix(info.Name(), cacheTempPrefix) {
+			if time.Since(info.ModTime()) > 24*time.Hour {
+				os.Remove(p)
+			}
+			return nil
+		}
+
+		cached = append(cached, cachedObject{path: p, size: info.Size(), lastUse: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sort.Sort(byLastUse(cached))
+
+	removed := 0
+	freed := int64(0)
+	for _, object := range cached {
+		if total-freed <= maxSize {
+			break
+		}
+
+		err = os.Remove(object.path)
+		if err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += object.size
+	}
+
+	if removed == 0 {
+		return 0, 0, nil
+	}
+
+	return removed, freed, cache.pruneIndex()
+}
+
+// Remove the index entries that refer to objects that are gone
+func (cache *objectCache) pruneIndex() error {
+	indexDir := filepath.Join(cache.dir, cacheIndex)
+
+	items, err := ioutil.ReadDir(indexDir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		itemDir := filepath.Join(indexDir, item.Name())
+		states, err := ioutil.ReadDir(itemDir)
+		if err != nil {
+			return err
+		}
+
+		remaining := len(states)
+		for _, state := range states {
+			indexPath := filepath.Join(itemDir, state.Name())
+
+			b, err := ioutil.ReadFile(indexPath)
+			if err != nil {
+				return err
+			}
+
+			objectPath, err := cache.objectPath(strings.TrimSpace(string(b)))
+			if err == nil {
+				_, err = os.Stat(objectPath)
+			}
+			if err != nil {
+				os.Remove(indexPath)
+				remaining--
+			}
+		}
+
+		if remaining == 0 {
+			os.Remove(itemDir)
+		}
+	}
+
+	return nil
+}
+
+func cacheDefaults() {
+	fmt.Printf("gojazz cache prune [options]\n")
+	flag.PrintDefaults()
+}
+
+func cacheOp() {
+	if len(os.Args) < 2 || os.Args[1] != "prune" {
+		cacheDefaults()
+		return
+	}
+	os.Args = os.Args[1:]
+
+	maxSize := flag.String("max-size", defaultCacheSize, "Evict the least recently used files until the cache is no larger than this size (e.g. 500M, 2G)")
+	all := flag.Bool("all", false, "Remove everything from the cache")
+	flag.Usage = cacheDefaults
+	flag.Parse()
+
+	size := int64(0)
+	if !*all {
+		var err error
+		size, err = parseSize(*maxSize)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	cache, err := openObjectCache(size)
+	if err != nil {
+		panic(err)
+	}
+
+	removed, freed, err := cache.prune(size)
+	if err != nil {
+		panic(err)
+	}
+
+	emit(Event{Type: EVENT_SUMMARY, Phase: "prune", Path: cache.dir, Files: removed, Bytes: freed, Message: fmt.Sprintf("Removed %v files (%v) from the cache", removed, formatBytes(freed))})
+}
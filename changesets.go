@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Find the change set by its item ID or by its number in the list of outgoing
+// change sets
+func findChangeSet(changeSets []soapchangeset, ref string) (soapchangeset, error) {
+	for _, changeSet := range changeSets {
+		if changeSet.ItemId == ref {
+			return changeSet, nil
+		}
+	}
+
+	index, err := strconv.Atoi(ref)
+	if err == nil && index >= 1 && index <= len(changeSets) {
+		return changeSets[index-1], nil
+	}
+
+	return soapchangeset{}, simpleWarning("There is no outgoing change set " + ref + ". Use 'gojazz changeset list' to find it.")
+}
+
+// The first line of the comment, or a placeholder when there is none
+func changeSetTitle(changeSet soapchangeset) string {
+	comment := strings.TrimSpace(changeSet.Comment)
+	if comment == "" {
+		return "<No comment>"
+	}
+
+	return strings.SplitN(comment, "\n", 2)[0]
+}
+
+func changesetDefaults() {
+	fmt.Printf("gojazz changeset create [options] -comment=<comment>\n")
+	fmt.Printf("gojazz changeset list [options]\n")
+	fmt.Printf("gojazz changeset current [options] <change set>\n")
+	fmt.Printf("gojazz changeset complete [options] [change set]\n")
+	fmt.Printf("gojazz changeset comment [options] <change set> <comment>\n")
+	flag.PrintDefaults()
+}
+
+// Manage the change sets of the repository workspace that checkins go to.
+// Change sets are given by their item ID or their number in the list.
+func changesetOp() {
+	if len(os.Args) < 2 {
+		changesetDefaults()
+		return
+	}
+	command := os.Args[1]
+	os.Args = os.Args[1:]
+
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	comment := flag.String("comment", "", "Comment of the new change set")
+	componentName := flag.String("component", "", "Name or ID of the component of the new change set")
+	flag.Usage = changesetDefaults
+	flag.Parse()
+
+	if *sandboxPath == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+
+	metadata := newMetaData()
+	err := metadata.load(filepath.Join(*sandboxPath, metadataFileName))
+	if err != nil {
+		panic(simpleWarning("Not a sandbox"))
+	}
+
+	if metadata.isstream {
+		panic(simpleWarning("The sandbox is loaded from a stream, which doesn't have change sets. Load again using a repository workspace."))
+	}
+	if metadata.readonly && command != "list" {
+		panic(simpleWarning("The sandbox is loaded from someone else's repository workspace, which you can't change. Load again using your own repository workspace."))
+	}
+
+	client := sandboxClient(metadata)
+
+	switch command {
+	case "create":
+		if *comment == "" {
+			emitWarning("Provide a comment with the -comment option and try again.")
+			changesetDefaults()
+			return
+		}
+
+		components, err := FindComponents(client, metadata.ccmBaseUrl, metadata.workspaceId)
+		if err != nil {
+			panic(err)
+		}
+		if len(components) == 0 {
+			panic(simpleWarning("There are no components in your repository workspace."))
+		}
+
+		component := components[0]
+		if *componentName != "" {
+			component, err = findComponent(components, *componentName)
+			if err != nil {
+				panic(err)
+			}
+		} else if len(components) > 1 {
+			panic(simpleWarning("Your repository workspace has several components, choose one with the -component option."))
+		}
+
+		changeSetId, err := CreateChangeSet(client, metadata.ccmBaseUrl, metadata.workspaceId, component.ScmInfo.ItemId, *comment)
+		if err != nil {
+			panic(err)
+		}
+
+		emit(Event{Type: EVENT_SUMMARY, Phase: "changeset", Path: changeSetId, Message: fmt.Sprintf("Created change set %v in %v, checkins go to it now", changeSetId, component.Name)})
+		return
+	case "list":
+		changeSets, err := FindOutgoingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, "")
+		if err != nil {
+			panic(err)
+		}
+
+		for i, changeSet := range changeSets {
+			state := "complete"
+			if changeSet.Current {
+				state = "current"
+			} else if changeSet.Active {
+				state = "active"
+			}
+			emitMessage("%v. %v (%v) %v, %v changes [%v]", i+1, changeSetTitle(changeSet), changeSet.Component.Name, changeSet.ItemId, len(changeSet.Changes), state)
+		}
+		if len(changeSets) == 0 {
+			emitMessage("No outgoing change sets")
+		}
+		return
+	case "current", "complete", "comment":
+	default:
+		changesetDefaults()
+		return
+	}
+
+	// The remaining commands work on an existing change set
+	changeSets, err := FindOutgoingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, "")
+	if err != nil {
+		panic(err)
+	}
+
+	var changeSet soapchangeset
+	if flag.NArg() > 0 {
+		changeSet, err = findChangeSet(changeSets, flag.Arg(0))
+		if err != nil {
+			panic(err)
+		}
+	} else if command == "complete" {
+		current := []soapchangeset{}
+		for _, cs := range changeSets {
+			if cs.Current {
+				current = append(current, cs)
+			}
+		}
+		if len(current) != 1 {
+			panic(simpleWarning("Provide the change set to complete and try again."))
+		}
+		changeSet = current[0]
+	} else {
+		emitWarning("Provide the change set and try again.")
+		changesetDefaults()
+		return
+	}
+
+	switch command {
+	case "current":
+		if !changeSet.Active {
+			panic(simpleWarning("The change set is complete, create a new change set instead."))
+		}
+
+		err = SetCurrentChangeSet(client, metadata.ccmBaseUrl, metadata.workspaceId, changeSet.Component.ItemId, changeSet.ItemId)
+		if err != nil {
+			panic(err)
+		}
+		emitMessage("Checkins to %v go to %v now", changeSet.Component.Name, changeSetTitle(changeSet))
+	case "complete":
+		if !changeSet.Active {
+			panic(simpleWarning("The change set is already complete."))
+		}
+
+		err = CompleteChangeSet(client, metadata.ccmBaseUrl, metadata.workspaceId, changeSet.ItemId)
+		if err != nil {
+			panic(err)
+		}
+		emitMessage("Completed %v", changeSetTitle(changeSet))
+	case "comment":
+		if flag.NArg() != 2 {
+			emitWarning("Provide the change set and the comment and try again.")
+			changesetDefaults()
+			return
+		}
+
+		err = SetChangeSetComment(client, metadata.ccmBaseUrl, changeSet.ItemId, flag.Arg(1))
+		if err != nil {
+			panic(err)
+		}
+		emitMessage("Changed the comment of %v", changeSet.ItemId)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFindChangeSet(t *testing.T) {
+	changeSets := []soapchangeset{
+		soapchangeset{ItemId: "_cs1", Comment: "Fix the login page\nand the tests", Active: true, Current: true},
+		soapchangeset{ItemId: "_cs2"},
+	}
+
+	for ref, expected := range map[string]string{"_cs2": "_cs2", "1": "_cs1", "2": "_cs2"} {
+		changeSet, err := findChangeSet(changeSets, ref)
+		if err != nil || changeSet.ItemId != expected {
+			t.Errorf("Change set %v should be %v: %v %v", ref, expected, changeSet.ItemId, err)
+		}
+	}
+
+	for _, ref := range []string{"0", "3", "_cs3"} {
+		if _, err := findChangeSet(changeSets, ref); err == nil {
+			t.Errorf("Change set %v should not be found", ref)
+		}
+	}
+
+	if title := changeSetTitle(changeSets[0]); title != "Fix the login page" {
+		t.Errorf("Unexpected title %v", title)
+	}
+	if title := changeSetTitle(changeSets[1]); title != "<No comment>" {
+		t.Errorf("Unexpected title %v", title)
+	}
+}
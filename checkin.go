@@ -12,25 +12,28 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 )
 
 func checkinDefaults() {
-	fmt.Printf("gojazz checkin [options]\n")
+	fmt.Printf("gojazz checkin [options] [paths or patterns...]\n")
 	flag.PrintDefaults()
 }
 
 func checkinOp() {
 	sandboxPath := flag.String("sandbox", "", "Location of the sandbox to load the files")
+	component := flag.String("component", "", "Name or ID of the component for new top-level files and folders")
+	transfer := transferFlags()
 	flag.Usage = checkinDefaults
 	flag.Parse()
+	transfer.apply()
 
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
 	if *sandboxPath == "" {
-		path, err := os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-
-		path = findSandbox(path)
+		path := findSandbox(cwd)
 		sandboxPath = &path
 	}
 
@@ -39,11 +42,28 @@ func checkinOp() {
 		panic(err)
 	}
 
+	// Only the selected changes are checked in, the rest stay pending
+	if flag.NArg() > 0 {
+		selection := newCheckinSelection(*sandboxPath, cwd, flag.Args())
+		pending := status.restrict(selection)
+
+		if status.unchanged() {
+			panic(simpleWarning("None of the local changes match the paths. Nothing was checked in."))
+		}
+		if pending > 0 {
+			emitMessage("%v other local changes are not checked in", pending)
+		}
+	}
+
 	if status.metaData.isstream {
 		panic(simpleWarning("The sandbox is loaded from a stream, which doesn't support check-ins. Load again using a repository workspace."))
 		return
 	}
 
+	if status.metaData.readonly {
+		panic(simpleWarning("The sandbox is loaded from someone else's repository workspace, which doesn't support check-ins. Load again using your own repository workspace."))
+	}
+
 	if status.unchanged() {
 		panic(simpleWarning("Sandbox is unchanged. Nothing was checked in."))
 		return
@@ -59,7 +79,7 @@ func checkinOp() {
 		panic(err)
 	}
 
-	scmCheckin(client, status, *sandboxPath)
+	conflicts := scmCheckin(client, status, *sandboxPath, *component)
 
 	// Force a load/reload of the jazzhub sandbox to avoid out of sync when
 	//  looking at the changes page
@@ -67,12 +87,143 @@ func checkinOp() {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println("Visit the following URL to work with your changes, deliver them to the rest of the team and more:")
 	redirect := fmt.Sprintf(jazzHubBaseUrl + "/code/jazzui/changes.html#" + "/code/jazz/Changes/_/file/" + client.GetJazzId() + "-OrionContent/" + status.metaData.projectName)
-	fmt.Printf("https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=%v\n", url.QueryEscape(redirect))
+	emit(Event{Type: EVENT_MESSAGE, Message: "Visit the following URL to work with your changes, deliver them to the rest of the team and more:", Url: "https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=" + url.QueryEscape(redirect)})
+
+	if len(conflicts) > 0 {
+		panic(simpleWarning(fmt.Sprintf("%v changes were not checked in because of conflicts with the repository workspace.", len(conflicts))))
+	}
+}
+
+// The files and folders to check in. Arguments with wildcards are patterns like
+// the ones in .jazzignore files, relative to the current folder.
+type checkinSelection struct {
+	paths    []string
+	patterns []ignorePattern
+}
+
+func newCheckinSelection(sandboxPath string, cwd string, args []string) *checkinSelection {
+	selection := &checkinSelection{}
+
+	base, err := filepath.Rel(sandboxPath, cwd)
+	if err != nil || base == "." || !inSandbox(base) {
+		base = ""
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			selection.patterns = append(selection.patterns, parseIgnorePatterns(arg, filepath.ToSlash(base))...)
+		} else {
+			selection.paths = append(selection.paths, sandboxPaths(sandboxPath, cwd, []string{arg})...)
+		}
+	}
+
+	return selection
+}
+
+// Everything inside of a selected folder is selected too
+func (selection *checkinSelection) selects(rel string, isDir bool) bool {
+	if withinAny(rel, selection.paths) {
+		return true
+	}
+
+	p := filepath.ToSlash(rel)
+	for dir := p; dir != "."; dir = path.Dir(dir) {
+		selected := false
+		for _, pattern := range selection.patterns {
+			if pattern.matches(dir, isDir || dir != p) {
+				selected = !pattern.negate
+			}
+		}
+		if selected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drop the changes that aren't selected from the status, except for the new
+// and moved parent folders that the selected changes need. Returns the number
+// of changes that were dropped.
+func (status *status) restrict(selection *checkinSelection) int {
+	loadedDir := func(rel string) bool {
+		meta := status.metaData.pathMap[rel]
+		return meta.Hash == "" && meta.LinkTarget == ""
+	}
+
+	added := make(map[string]bool)
+	modified := make(map[string]bool)
+	deleted := make(map[string]bool)
+	moved := make(map[string]string)
+
+	for rel, _ := range status.Added {
+		info, err := os.Lstat(filepath.Join(status.sandboxPath, rel))
+		if selection.selects(rel, err == nil && info.IsDir()) {
+			added[rel] = true
+		}
+	}
+	for rel, _ := range status.Deleted {
+		if selection.selects(rel, loadedDir(rel)) {
+			deleted[rel] = true
+		}
+	}
+
+	// A moved and modified item goes along in both ways
+	for to, from := range status.Moved {
+		if selection.selects(to, loadedDir(from)) || selection.selects(from, loadedDir(from)) {
+			moved[to] = from
+		}
+	}
+	for rel, _ := range status.Modified {
+		from, ok := status.Moved[rel]
+		if !ok {
+			from = rel
+		}
+		if selection.selects(rel, false) || moved[rel] != "" {
+			modified[rel] = true
+			if ok {
+				moved[rel] = from
+			}
+		}
+	}
+
+	// Parent folders that are new or moved in the sandbox
+	parents := func(rel string) {
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			if status.Added[dir] {
+				added[dir] = true
+			}
+			if from, ok := status.Moved[dir]; ok {
+				moved[dir] = from
+			}
+		}
+	}
+	for rel, _ := range added {
+		parents(rel)
+	}
+	for rel, _ := range modified {
+		parents(rel)
+	}
+	for rel, _ := range moved {
+		parents(rel)
+	}
+
+	pending := len(status.Added) + len(status.Modified) + len(status.Deleted) + len(status.Moved)
+	pending -= len(added) + len(modified) + len(deleted) + len(moved)
+
+	status.Added = added
+	status.Modified = modified
+	status.Deleted = deleted
+	status.Moved = moved
+
+	return pending
 }
 
-func scmCheckin(client *Client, status *status, sandboxPath string) {
+// Check in the changes of the status. Returns the paths of the changes that
+// weren't checked in because their items changed in the repository workspace
+// since they were loaded.
+func scmCheckin(client *Client, status *status, sandboxPath string, component string) []string {
 	// Get the workspace in order to force the authentication to happen
 	//  and get the list of components.
 	workspaceId := status.metaData.workspaceId
@@ -83,244 +234,502 @@ func scmCheckin(client *Client, status *status, sandboxPath string) {
 		panic(err)
 	}
 
-	// TODO Probe the remote workspace to verify that it is in sync with this sandbox
-	//   - Warn the user if they are out of sync
-	//   - Tell them that check-in will make a best effort to find the correct places
-	//      to attach the local changes
-	//   - Ask them if they wish to proceed
+	// New items that aren't inside of a loaded folder need a component, which
+	//  is decided before anything is checked in
+	chooser := newComponentChooser(components, status.metaData, component)
+	newComponents := make(map[string]string)
+	for addedpath, _ := range status.Added {
+		parent := filepath.Dir(addedpath)
+		if _, ok := status.metaData.pathMap[parent]; ok || status.Added[parent] {
+			continue
+		}
+		if from, ok := status.Moved[parent]; ok {
+			newComponents[addedpath] = status.metaData.pathMap[from].ComponentId
+			continue
+		}
 
-	defaultComponentId := ""
-	for idx, component := range components {
-		if idx == 0 || strings.HasSuffix(component.Name, "Default Component") {
-			defaultComponentId = component.ScmInfo.ItemId
-			break
+		componentId, err := chooser.choose(addedpath)
+		if err != nil {
+			panic(err)
 		}
+		newComponents[addedpath] = componentId
 	}
-	if defaultComponentId == "" {
-		panic(simpleWarning("There are no components in your repository workspace."))
+
+	emit(Event{Type: EVENT_PHASE_STARTED, Phase: "checkin", Path: sandboxPath})
+	checkedIn := 0
+
+	// Moves come first so that changes inside of moved folders find their items
+	checkedIn += checkinMoves(client, status, sandboxPath)
+
+	pristine := status.metaData.pristineStore(sandboxPath)
+
+	// Items that changed in the repository workspace since they were loaded are
+	//  never overwritten or deleted
+	conflicts := []string{}
+	conflictsMutex := &sync.Mutex{}
+	conflicted := func(rel string) {
+		conflictsMutex.Lock()
+		defer conflictsMutex.Unlock()
+
+		emit(Event{Type: EVENT_CHANGE, Phase: "checkin", Path: filepath.ToSlash(rel), Change: "Conflict"})
+		conflicts = append(conflicts, rel)
 	}
 
-	for modifiedpath, _ := range status.Modified {
-		fmt.Printf("%v (Modified)\n", modifiedpath)
+	// Metadata is only read and updated here, the workers get what they need
+	//  up front and hand back their results
+	finish := func(failure interface{}) {
+		finishCheckin(status.metaData, sandboxPath, failure)
+	}
 
-		localpath := filepath.Join(sandboxPath, modifiedpath)
-		stagepath := filepath.Join(sandboxPath, stageFolder, modifiedpath)
-		remotepath := filepath.ToSlash(modifiedpath)
+	modified := sortedPaths(status.Modified, []string{"."})
+	modifiedMeta := make(map[string]metaObject)
+	unresolved := make(map[string]bool)
+	for _, modifiedpath := range modified {
+		unresolved[modifiedpath] = status.metaData.conflicts[modifiedpath]
 
-		meta, ok := status.metaData.get(localpath, sandboxPath)
-		componentId := ""
+		meta, ok := status.metaData.get(filepath.Join(sandboxPath, modifiedpath), sandboxPath)
 		if !ok {
 			// This shouldn't happen. Log the stack if it does.
 			panic(&JazzError{Msg: "Metadata not found for file that was found in the metadata", Log: true})
-		} else {
-			componentId = meta.ComponentId
 		}
+		modifiedMeta[modifiedpath] = meta
+	}
 
-		remoteFile, err := Open(client, ccmBaseUrl, workspaceId, componentId, remotepath)
-		if err != nil {
-			// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
-			//  parent directories are not there.
-			fileerror, ok := err.(*JazzError)
-
-			if ok && fileerror.StatusCode == 404 {
-				fmt.Printf("Cannot check-in file at path %v since it no longer exists at the same location on the remote.\n", remotepath)
-				fmt.Printf("The file has been temporarily backed up in the following location: %v\n", stagepath)
-				continue
+	failure := checkinParallel(modified, func(modifiedpath string) (metaObject, bool) {
+		return checkinModified(client, status, sandboxPath, modifiedpath, modifiedMeta[modifiedpath], unresolved[modifiedpath], pristine, conflicted)
+	}, func(modifiedpath string, newmeta metaObject) {
+		status.metaData.simplePut(newmeta, sandboxPath)
+		emit(Event{Type: EVENT_FILE_CHECKED_IN, Phase: "checkin", Path: modifiedpath, Change: "Modified"})
+		checkedIn++
+	})
+	finish(failure)
+
+	// Parent folders are added before their contents, one level at a time
+	added := sortedPaths(status.Added, []string{"."})
+	for _, level := range pathsByDepth(added) {
+
+		// We need to find the component to add each item. It will either be the
+		//  the parent element, which we may have just added, or the component
+		//  that was chosen for it.
+		components := make(map[string]string)
+		for _, addedpath := range level {
+			parentMeta, ok := status.metaData.get(filepath.Dir(filepath.Join(sandboxPath, addedpath)), sandboxPath)
+			if ok {
+				components[addedpath] = parentMeta.ComponentId
+			} else if componentId, ok := newComponents[addedpath]; ok {
+				components[addedpath] = componentId
+			} else {
+				componentId, err := chooser.choose(addedpath)
+				if err != nil {
+					finish(err)
+				}
+				components[addedpath] = componentId
 			}
-
-			panic(err)
 		}
 
-		// TODO better checking and matching for the file, perhaps by item ID?
-		if remoteFile.info.Directory {
-			fmt.Printf("Cannot check-in file at path %v. There is a folder at this location on the remote.\n", modifiedpath)
-			fmt.Printf("The file has been temporarily backed up in the following location: %v\n", stagepath)
-			continue
+		failure = checkinParallel(level, func(addedpath string) (metaObject, bool) {
+			return checkinAdded(client, status, sandboxPath, addedpath, components[addedpath], pristine)
+		}, func(addedpath string, newmeta metaObject) {
+			status.metaData.simplePut(newmeta, sandboxPath)
+			emit(Event{Type: EVENT_FILE_CHECKED_IN, Phase: "checkin", Path: addedpath, Change: "Added"})
+			checkedIn++
+		})
+		finish(failure)
+	}
+
+	// Deletes go deepest first, one level at a time
+	deleted := pathsByDepth(sortedPaths(status.Deleted, []string{"."}))
+	for idx := len(deleted) - 1; idx >= 0; idx-- {
+		deletedMeta := make(map[string]metaObject)
+		for _, deletedpath := range deleted[idx] {
+			meta, ok := status.metaData.get(filepath.Join(sandboxPath, deletedpath), sandboxPath)
+			if !ok {
+				// This should never really happen but log it if it does.
+				panic(&JazzError{Msg: "Metadata not found for deleted item discovered in the metadata.", Log: true})
+			}
+			deletedMeta[deletedpath] = meta
 		}
-		// Ooops, this is the wrong file
-		if remoteFile.info.ScmInfo.ItemId != meta.ItemId {
-			fmt.Printf("Cannot check-in file at path %v. It is not the same as the one that was originally loaded.\n", modifiedpath)
-			fmt.Printf("The file has been temporarily backed up in the following location: %v\n", stagepath)
-			continue
+
+		failure = checkinParallel(deleted[idx], func(deletedpath string) (metaObject, bool) {
+			meta := deletedMeta[deletedpath]
+			remotepath := filepath.ToSlash(deletedpath)
+
+			// Folders get new states when their contents change, only files are compared
+			if meta.Hash != "" || meta.LinkTarget != "" {
+				remoteFile, err := Open(client, ccmBaseUrl, workspaceId, meta.ComponentId, remotepath)
+				if err == nil && remoteFile.info.ScmInfo.StateId != meta.StateId {
+					emitWarning("Cannot delete file at path %v. It was changed in the repository workspace since it was loaded.", remotepath)
+					conflicted(deletedpath)
+					return metaObject{}, false
+				}
+			}
+
+			err := Remove(client, ccmBaseUrl, workspaceId, meta.ComponentId, remotepath)
+			if err != nil {
+				// First, check to see if this is a 404 (Not Found). If the file is already deleted
+				//  then this is an acceptable resolution to the checkin. One reason it may be already
+				//  deleted is that it is a child of a directory that is already deleted.
+				fileerror, ok := err.(*JazzError)
+				if !ok || fileerror.StatusCode != 404 {
+					panic(err)
+				}
+			}
+
+			return metaObject{}, true
+		}, func(deletedpath string, _ metaObject) {
+			delete(status.metaData.pathMap, deletedpath)
+			emit(Event{Type: EVENT_FILE_CHECKED_IN, Phase: "checkin", Path: deletedpath, Change: "Deleted"})
+			checkedIn++
+		})
+		finish(failure)
+	}
+
+	err = status.metaData.save(filepath.Join(sandboxPath, metadataFileName))
+	if err != nil {
+		panic(err)
+	}
+
+	if pristine != nil {
+		err = pristine.prune(status.metaData)
+		if err != nil {
+			emitWarning("Unable to prune the pristine copies: %v", err)
 		}
+	}
 
-		newmeta := checkinFile(client, stagepath, remoteFile)
-		newmeta.Path = localpath
+	if len(conflicts) > 0 {
+		emitWarning("%v changes were not checked in because their files changed in the repository workspace since they were loaded. Sync to merge the new versions with your changes.", len(conflicts))
+	}
 
-		status.metaData.simplePut(newmeta, sandboxPath)
+	emit(Event{Type: EVENT_PHASE_FINISHED, Phase: "checkin", Path: sandboxPath, Files: checkedIn, Message: "Checkin Complete"})
+
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// Stop the checkin after a failure. What was checked in so far is kept in the
+// metadata so that it isn't checked in again.
+func finishCheckin(metadata *metaData, sandboxPath string, failure interface{}) {
+	if failure == nil {
+		return
 	}
 
-	addedFiles := make([]string, len(status.Added))
-	idx := 0
+	err := metadata.save(filepath.Join(sandboxPath, metadataFileName))
+	if err != nil {
+		emitWarning("Unable to save the metadata of the files that were checked in: %v", err)
+	}
+	panic(failure)
+}
 
-	for addedpath, _ := range status.Added {
-		addedFiles[idx] = addedpath
-		idx++
+// Check in the changes at the paths with a pool of workers that is bounded by
+// the upload limiter. The results are applied as they come in, from the calling
+// goroutine only. Unless a change is skipped with a warning it is applied. The
+// first failure is returned once the changes in flight have finished, the rest
+// aren't started.
+func checkinParallel(paths []string, checkin func(rel string) (metaObject, bool), apply func(rel string, meta metaObject)) interface{} {
+	if len(paths) == 0 {
+		return nil
 	}
 
-	sort.StringSlice(addedFiles).Sort()
+	queue := make(chan string)
+	results := make(chan checkinResult)
+	abort := make(chan bool)
+	aborting := &sync.Once{}
+
+	go func() {
+		defer close(queue)
+		for _, p := range paths {
+			select {
+			case queue <- p:
+			case <-abort:
+				return
+			}
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < uploadLimiter.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range queue {
+				// Paths that were already queued are dropped after a failure
+				select {
+				case <-abort:
+					continue
+				default:
+				}
 
-	for _, addedpath := range addedFiles {
-		fmt.Printf("%v (Added)\n", addedpath)
+				result := checkinOne(rel, checkin)
+				if result.failure != nil {
+					aborting.Do(func() { close(abort) })
+				}
+				results <- result
+			}
+		}()
+	}
 
-		localpath := filepath.Join(sandboxPath, addedpath)
-		remotepath := filepath.ToSlash(addedpath)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-		info, err := os.Stat(localpath)
-		if err != nil {
-			panic(err)
+	var failure interface{}
+	for result := range results {
+		if result.failure != nil {
+			if failure == nil {
+				failure = result.failure
+			}
+			continue
 		}
 
-		// We need to find the component to add this file. It will either be the
-		//  the parent element, which we may have just added, or its the default component.
-		parentMeta, ok := status.metaData.get(filepath.Dir(localpath), sandboxPath)
-		componentId := ""
-		if ok {
-			componentId = parentMeta.ComponentId
-		} else {
-			componentId = defaultComponentId
+		if result.ok {
+			apply(result.rel, result.meta)
 		}
+	}
 
-		if info.IsDir() {
-			remoteFolder, err := Mkdir(client, ccmBaseUrl, workspaceId, componentId, remotepath)
-			if err != nil {
-				// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
-				//  parent directories are not there.
-				fileerror, ok := err.(*JazzError)
+	return failure
+}
 
-				if ok && fileerror.StatusCode == 404 {
-					// One last crack at this is to create all of the necessary parent directories and then add the file to it
-					parentDir := path.Dir(remotepath)
-					_, err := MkdirAll(client, ccmBaseUrl, workspaceId, componentId, parentDir)
-					if err != nil {
-						panic(err)
-					}
-
-					// Try again now that the parent directory is there
-					remoteFolder, err = Mkdir(client, ccmBaseUrl, workspaceId, componentId, remotepath)
-					if err != nil {
-						panic(err)
-					}
-				} else {
-					panic(err)
-				}
-			}
+type checkinResult struct {
+	rel     string
+	meta    metaObject
+	ok      bool
+	failure interface{}
+}
 
-			meta := metaObject{}
-			meta.Path = localpath
-			meta.ItemId = remoteFolder.info.ScmInfo.ItemId
-			meta.StateId = remoteFolder.info.ScmInfo.StateId
-			meta.ComponentId = remoteFolder.info.ScmInfo.ComponentId
+// Failures of the workers are handed back instead of taking down the process
+func checkinOne(rel string, checkin func(rel string) (metaObject, bool)) (result checkinResult) {
+	result.rel = rel
 
-			status.metaData.simplePut(meta, sandboxPath)
-		} else {
-			remoteFile, err := Create(client, ccmBaseUrl, workspaceId, componentId, remotepath)
-			if err != nil {
-				// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
-				//  parent directories are not there.
-				fileerror, ok := err.(*JazzError)
+	uploadLimiter.acquire()
+	defer func() {
+		result.failure = recover()
 
-				if ok && fileerror.StatusCode == 404 {
-					// One last crack at this is to create all of the necessary parent directories and then add the file to it
-					parentDir := path.Dir(remotepath)
-					_, err := MkdirAll(client, ccmBaseUrl, workspaceId, componentId, parentDir)
-					if err != nil {
-						panic(err)
-					}
-
-					// Try again now that the parent directory is there
-					remoteFile, err = Create(client, ccmBaseUrl, workspaceId, componentId, remotepath)
-					if err != nil {
-						panic(err)
-					}
-				} else {
-					panic(err)
-				}
-			}
+		var err error
+		if result.failure != nil {
+			err = fmt.Errorf("%v", result.failure)
+		}
+		uploadLimiter.release(0, err)
+	}()
 
-			stagepath := filepath.Join(sandboxPath, stageFolder, addedpath)
-			newmeta := checkinFile(client, stagepath, remoteFile)
-			newmeta.Path = localpath
-			status.metaData.simplePut(newmeta, sandboxPath)
+	result.meta, result.ok = checkin(rel)
+	return
+}
+
+// Group the sorted paths by their number of folders
+func pathsByDepth(paths []string) [][]string {
+	levels := [][]string{}
+
+	for _, p := range paths {
+		depth := strings.Count(p, string(filepath.Separator))
+		for len(levels) <= depth {
+			levels = append(levels, []string{})
 		}
+		levels[depth] = append(levels[depth], p)
 	}
 
-	deletedFiles := make([]string, len(status.Deleted))
-	idx = 0
-	for deletedpath, _ := range status.Deleted {
-		deletedFiles[idx] = deletedpath
-		idx++
+	return levels
+}
+
+func checkinModified(client *Client, status *status, sandboxPath string, modifiedpath string, meta metaObject, unresolved bool, pristine *pristineStore, conflicted func(rel string)) (metaObject, bool) {
+	workspaceId := status.metaData.workspaceId
+	ccmBaseUrl := status.metaData.ccmBaseUrl
+
+	localpath := filepath.Join(sandboxPath, modifiedpath)
+	stagepath := filepath.Join(sandboxPath, stageFolder, modifiedpath)
+	remotepath := filepath.ToSlash(modifiedpath)
+	componentId := meta.ComponentId
+
+	remoteFile, err := Open(client, ccmBaseUrl, workspaceId, componentId, remotepath)
+	if err != nil {
+		// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
+		//  parent directories are not there.
+		fileerror, ok := err.(*JazzError)
+
+		if ok && fileerror.StatusCode == 404 {
+			emitWarning("Cannot check-in file at path %v since it no longer exists at the same location on the remote.", remotepath)
+			emitWarning("The file has been temporarily backed up in the following location: %v", stagepath)
+			return metaObject{}, false
+		}
+
+		panic(err)
 	}
 
-	sort.StringSlice(deletedFiles).Sort()
+	// TODO better checking and matching for the file, perhaps by item ID?
+	if remoteFile.info.Directory {
+		emitWarning("Cannot check-in file at path %v. There is a folder at this location on the remote.", modifiedpath)
+		emitWarning("The file has been temporarily backed up in the following location: %v", stagepath)
+		return metaObject{}, false
+	}
+	// Ooops, this is the wrong file
+	if remoteFile.info.ScmInfo.ItemId != meta.ItemId {
+		emitWarning("Cannot check-in file at path %v. It is not the same as the one that was originally loaded.", modifiedpath)
+		emitWarning("The file has been temporarily backed up in the following location: %v", stagepath)
+		return metaObject{}, false
+	}
+	// Someone else changed the file, writing it would lose their change
+	if remoteFile.info.ScmInfo.StateId != meta.StateId {
+		emitWarning("Cannot check-in file at path %v. It was changed in the repository workspace since it was loaded.", modifiedpath)
+		emitWarning("The file has been temporarily backed up in the following location: %v", stagepath)
+		conflicted(modifiedpath)
+		return metaObject{}, false
+	}
+	if unresolved {
+		emitWarning("Cannot check-in file at path %v. It has conflicts from a merge, resolve them first and mark the file with 'gojazz resolve'.", modifiedpath)
+		return metaObject{}, false
+	}
 
-	for idx = len(deletedFiles) - 1; idx >= 0; idx-- {
-		deletedpath := deletedFiles[idx]
-		remotepath := filepath.ToSlash(deletedpath)
+	stageInfo, err := os.Lstat(stagepath)
+	if err != nil {
+		panic(err)
+	}
 
-		fmt.Printf("%v (Deleted)\n", deletedpath)
-		deletedpath = filepath.Join(sandboxPath, deletedpath)
+	var newmeta metaObject
+	if isSymlink(stageInfo) {
+		if !checkinLinkAllowed(sandboxPath, localpath, stagepath) {
+			return metaObject{}, false
+		}
 
-		componentId := ""
+		// The item changed from a file into a link, replace it on the remote
+		if !remoteFile.info.Attributes.SymbolicLink {
+			err = Remove(client, ccmBaseUrl, workspaceId, componentId, remotepath)
+			if err != nil {
+				panic(err)
+			}
 
-		meta, ok := status.metaData.get(deletedpath, sandboxPath)
-		if !ok {
-			// This should never really happen but log it if it does.
-			panic(&JazzError{Msg: "Metadata not found for deleted item discovered in the metadata.", Log: true})
+			newmeta = checkinNewLink(client, ccmBaseUrl, workspaceId, componentId, remotepath, stagepath)
 		} else {
-			componentId = meta.ComponentId
+			newmeta = checkinLink(stagepath, remoteFile)
 		}
+	} else if meta.LinkTarget != "" || remoteFile.info.Attributes.SymbolicLink {
+		emitWarning("Cannot check-in file at path %v. It is a symbolic link in the repository that was loaded as a plain file.", modifiedpath)
+		emitWarning("The file has been temporarily backed up in the following location: %v", stagepath)
+		return metaObject{}, false
+	} else {
+		newmeta = checkinFile(client, stagepath, status.copied[modifiedpath], remoteFile, status.metaData.eolStyleFor(modifiedpath), pristine)
+	}
+	newmeta.Path = localpath
 
-		remotePath, err := filepath.Rel(sandboxPath, deletedpath)
-		if err != nil {
-			panic(err)
+	return newmeta, true
+}
+
+func checkinAdded(client *Client, status *status, sandboxPath string, addedpath string, componentId string, pristine *pristineStore) (metaObject, bool) {
+	workspaceId := status.metaData.workspaceId
+	ccmBaseUrl := status.metaData.ccmBaseUrl
+
+	localpath := filepath.Join(sandboxPath, addedpath)
+	remotepath := filepath.ToSlash(addedpath)
+
+	info, err := os.Lstat(localpath)
+	if err != nil {
+		panic(err)
+	}
+
+	if isSymlink(info) {
+		stagepath := filepath.Join(sandboxPath, stageFolder, addedpath)
+		if !checkinLinkAllowed(sandboxPath, localpath, stagepath) {
+			return metaObject{}, false
 		}
 
-		err = Remove(client, ccmBaseUrl, workspaceId, componentId, remotepath)
+		newmeta := checkinNewLink(client, ccmBaseUrl, workspaceId, componentId, remotepath, stagepath)
+		newmeta.Path = localpath
+		return newmeta, true
+	} else if info.IsDir() {
+		remoteFolder, err := Mkdir(client, ccmBaseUrl, workspaceId, componentId, remotepath)
 		if err != nil {
-			// First, check to see if this is a 404 (Not Found). If the file is already deleted
-			//  then this is an acceptable resolution to the checkin. One reason it may be already
-			//  deleted is that it is a child of a directory that is already deleted.
+			// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
+			//  parent directories are not there.
 			fileerror, ok := err.(*JazzError)
-			if !ok || fileerror.StatusCode != 404 {
+
+			if ok && fileerror.StatusCode == 404 {
+				// One last crack at this is to create all of the necessary parent directories and then add the file to it
+				parentDir := path.Dir(remotepath)
+				_, err := MkdirAll(client, ccmBaseUrl, workspaceId, componentId, parentDir)
+				if err != nil {
+					panic(err)
+				}
+
+				// Try again now that the parent directory is there
+				remoteFolder, err = Mkdir(client, ccmBaseUrl, workspaceId, componentId, remotepath)
+				if err != nil {
+					panic(err)
+				}
+			} else {
 				panic(err)
 			}
 		}
 
-		delete(status.metaData.pathMap, remotePath)
+		meta := metaObject{}
+		meta.Path = localpath
+		meta.ItemId = remoteFolder.info.ScmInfo.ItemId
+		meta.StateId = remoteFolder.info.ScmInfo.StateId
+		meta.ComponentId = remoteFolder.info.ScmInfo.ComponentId
+
+		return meta, true
 	}
 
-	err = status.metaData.save(filepath.Join(sandboxPath, metadataFileName))
+	remoteFile, err := Create(client, ccmBaseUrl, workspaceId, componentId, remotepath)
 	if err != nil {
-		panic(err)
+		// First, check to see if this is a 404 (Not Found). This can occur when one or more of the
+		//  parent directories are not there.
+		fileerror, ok := err.(*JazzError)
+
+		if ok && fileerror.StatusCode == 404 {
+			// One last crack at this is to create all of the necessary parent directories and then add the file to it
+			parentDir := path.Dir(remotepath)
+			_, err := MkdirAll(client, ccmBaseUrl, workspaceId, componentId, parentDir)
+			if err != nil {
+				panic(err)
+			}
+
+			// Try again now that the parent directory is there
+			remoteFile, err = Create(client, ccmBaseUrl, workspaceId, componentId, remotepath)
+			if err != nil {
+				panic(err)
+			}
+		} else {
+			panic(err)
+		}
 	}
 
-	fmt.Println("Checkin Complete")
+	stagepath := filepath.Join(sandboxPath, stageFolder, addedpath)
+	newmeta := checkinFile(client, stagepath, status.copied[addedpath], remoteFile, status.metaData.eolStyleFor(addedpath), pristine)
+	newmeta.Path = localpath
+
+	return newmeta, true
 }
 
-func checkinFile(client *Client, localPath string, remoteFile *File) metaObject {
+// Upload the staged file. The stat information of the sandbox file from when
+// it was staged is recorded, the staged file itself is gone afterwards.
+func checkinFile(client *Client, localPath string, sandboxInfo os.FileInfo, remoteFile *File, eol eolStyle, pristine *pristineStore) metaObject {
 	file, err := os.Open(localPath)
 	if err != nil {
 		panic(err)
 	}
 	defer file.Close()
 
-	// Setup the SHA-1 hash of the file contents
+	// Setup the SHA-1 hash of the file contents. The contents are normalized
+	//  to the repository's line delimiters on the way up.
 	hash := sha1.New()
-	tee := io.TeeReader(file, hash)
+	tee := io.TeeReader(normalizeEol(file, eol), hash)
 
 	newmeta := metaObject{}
 	newmeta.ItemId = remoteFile.info.ScmInfo.ItemId
 
 	newmeta.ComponentId = remoteFile.info.ScmInfo.ComponentId
 
-	info, err := os.Stat(localPath)
-	if err != nil {
-		panic(err)
-	}
+	if sandboxInfo == nil {
+		// Without the stat of the sandbox file it will be hashed again next time
+		info, err := os.Stat(localPath)
+		if err != nil {
+			panic(err)
+		}
 
-	newmeta.LastModified = info.ModTime().Unix()
-	newmeta.Size = info.Size()
+		newmeta.LastModified = info.ModTime().Unix()
+		newmeta.Size = info.Size()
+	} else {
+		newmeta.recordStat(sandboxInfo)
+	}
 
 	err = remoteFile.Write(tee)
 	if err != nil {
@@ -334,6 +743,11 @@ func checkinFile(client *Client, localPath string, remoteFile *File) metaObject
 	// The new stateId is assigned to the remoteFile after a successful write
 	newmeta.StateId = remoteFile.info.ScmInfo.StateId
 
+	// The checked in contents are the new loaded version
+	if pristine != nil {
+		keepPristine(pristine, localPath, eol, newmeta.Hash)
+	}
+
 	// This is the staged file, we can delete it to save disk space since it was uploaded without error
 	file.Close()
 	os.Remove(localPath)
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCheckinSelection(t *testing.T) {
+	sandbox, err := ioutil.TempDir("", "gojazz-checkin")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	for _, dir := range []string{"src/util", "docs", "lib"} {
+		err = os.MkdirAll(filepath.Join(sandbox, dir), 0700)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	status := newStatus(sandbox, NO_COPY)
+	status.metaData = newMetaData()
+	status.metaData.pathMap["lib"] = metaObject{ItemId: "lib"}
+	status.metaData.pathMap["old.go"] = metaObject{ItemId: "old", Hash: "x"}
+	status.metaData.pathMap["scratch.txt"] = metaObject{ItemId: "scratch", Hash: "y"}
+
+	status.Added["src"] = true
+	status.Added["src/util"] = true
+	status.Added["src/util/a.go"] = true
+	status.Added["src/b.go"] = true
+	status.Added["docs/a.md"] = true
+	status.Modified["scratch.txt"] = true
+	status.Deleted["old.go"] = true
+	status.Moved["docs"] = "lib"
+
+	selection := newCheckinSelection(sandbox, sandbox, []string{"src/util/a.go", "*.md"})
+	pending := status.restrict(selection)
+
+	// The new parent folders and the moved folder of the Markdown file come along
+	for _, rel := range []string{"src", "src/util", "src/util/a.go", "docs/a.md"} {
+		if !status.Added[filepath.FromSlash(rel)] {
+			t.Errorf("Expected %v to be checked in", rel)
+		}
+	}
+	if status.Moved["docs"] != "lib" {
+		t.Errorf("Expected the move of docs to be checked in")
+	}
+	if status.Added["src/b.go"] || status.Modified["scratch.txt"] || status.Deleted["old.go"] {
+		t.Errorf("Expected the other changes to stay pending: %v", status)
+	}
+	if pending != 3 {
+		t.Errorf("Expected 3 pending changes, got %v", pending)
+	}
+}
+
+func TestPathsByDepth(t *testing.T) {
+	paths := []string{"a", filepath.Join("a", "b"), filepath.Join("a", "b", "c"), "d", filepath.Join("d", "e")}
+
+	levels := pathsByDepth(paths)
+	expected := [][]string{{"a", "d"}, {filepath.Join("a", "b"), filepath.Join("d", "e")}, {filepath.Join("a", "b", "c")}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Parents should come a level before their contents: %v", levels)
+	}
+
+	if levels = pathsByDepth([]string{filepath.Join("a", "b")}); len(levels) != 2 || len(levels[0]) != 0 {
+		t.Errorf("Levels without paths should be kept so that the depth matches: %v", levels)
+	}
+}
+
+func TestCheckinParallel(t *testing.T) {
+	previous := uploadLimiter
+	defer func() { uploadLimiter = previous }()
+
+	// Every change is applied from the calling goroutine
+	uploadLimiter = newConcurrencyLimiter(4, false)
+	paths := []string{"a", "b", "c", "d", "e", "f"}
+	applied := []string{}
+	failure := checkinParallel(paths, func(rel string) (metaObject, bool) {
+		return metaObject{ItemId: rel}, rel != "d"
+	}, func(rel string, meta metaObject) {
+		if meta.ItemId != rel {
+			t.Errorf("The result of %v was applied to %v", meta.ItemId, rel)
+		}
+		applied = append(applied, rel)
+	})
+	sort.Strings(applied)
+	if failure != nil || !reflect.DeepEqual(applied, []string{"a", "b", "c", "e", "f"}) {
+		t.Errorf("All changes but the skipped one should be applied: %v %v", applied, failure)
+	}
+
+	// The first failure stops new work, what was checked in before is saved
+	sandbox, err := ioutil.TempDir("", "gojazz-checkin")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	uploadLimiter = newConcurrencyLimiter(1, false)
+	md := newMetaData()
+	started := []string{}
+	failure = checkinParallel(paths, func(rel string) (metaObject, bool) {
+		started = append(started, rel)
+		if rel == "c" {
+			panic(simpleWarning("Upload of c failed"))
+		}
+		return metaObject{Path: filepath.Join(sandbox, rel), ItemId: rel}, true
+	}, func(rel string, meta metaObject) {
+		md.simplePut(meta, sandbox)
+	})
+	if failure == nil {
+		t.Fatalf("The failure should be returned")
+	}
+	if !reflect.DeepEqual(started, []string{"a", "b", "c"}) {
+		t.Errorf("No changes should be started after the failure: %v", started)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != failure {
+				t.Errorf("The checkin should stop with the failure: %v", r)
+			}
+		}()
+		finishCheckin(md, sandbox, failure)
+	}()
+
+	saved := newMetaData()
+	err = saved.load(filepath.Join(sandbox, metadataFileName))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(saved.pathMap) != 2 || saved.pathMap["a"].ItemId != "a" || saved.pathMap["b"].ItemId != "b" {
+		t.Errorf("The changes before the failure should be saved: %v", saved.pathMap)
+	}
+}
+
+func TestStagedStat(t *testing.T) {
+	_, restore := captureEvents()
+	defer restore()
+
+	sandbox := loadedSandbox(t, map[string]string{"main.txt": "loaded\n"}, nil)
+	defer os.RemoveAll(sandbox)
+
+	path := filepath.Join(sandbox, "main.txt")
+	err := ioutil.WriteFile(path, []byte("changed\n"), 0600)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	status, err := scmStatus(sandbox, STAGE)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	info := status.copied["main.txt"]
+	if !status.Modified["main.txt"] || info == nil {
+		t.Fatalf("The modified file should be staged with its stat: %v", status)
+	}
+
+	// The recorded stat is the one of the sandbox file, not of the staged copy
+	meta := metaObject{}
+	meta.recordStat(info)
+	current, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !meta.statMatches(current, time.Now().Add(time.Second)) {
+		t.Errorf("The stat should match the unchanged sandbox file")
+	}
+
+	// Edits made after staging are still noticed
+	err = ioutil.WriteFile(path, []byte("changed again\n"), 0600)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	current, err = os.Lstat(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if meta.statMatches(current, time.Now().Add(time.Second)) {
+		t.Errorf("The stat should not match the file edited after staging")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// ioctl request for cloning a file on copy-on-write file systems (e.g. Btrfs, XFS)
+const ficlone = 0x40049409
+
+// Create a copy-on-write clone of the file. The clone shares its blocks with
+// the original until either one is modified.
+func cloneFile(src string, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd())
+	dstFile.Close()
+	if errno != 0 {
+		os.Remove(dst)
+		return errno
+	}
+
+	return nil
+}
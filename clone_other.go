@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// Cloning files isn't supported on this platform, the contents are copied instead
+func cloneFile(src string, dst string) error {
+	return errors.New("cloning files is not supported")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func compareDefaults() {
+	fmt.Printf("gojazz compare [options] <source> <target>\n")
+	flag.PrintDefaults()
+}
+
+// A difference between two configurations. Moved items have the path in the
+// source in from.
+type comparison struct {
+	change string
+	path   string
+	from   string
+	source *remoteEntry
+	target *remoteEntry
+}
+
+type byComparisonPath []comparison
+
+func (a byComparisonPath) Len() int      { return len(a) }
+func (a byComparisonPath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byComparisonPath) Less(i, j int) bool {
+	if a[i].path == a[j].path {
+		return a[i].change < a[j].change
+	}
+	return a[i].path < a[j].path
+}
+
+func compareOp() {
+	projectName := flag.String("project", "", "Project of the streams or repository workspaces, by default the project of the sandbox in the current directory")
+	showDiff := flag.Bool("diff", false, "Show the differences in the contents of changed text files")
+	transfer := transferFlags()
+	flag.Usage = compareDefaults
+	flag.Parse()
+	transfer.apply()
+
+	if flag.NArg() != 2 {
+		emitWarning("Provide a source and a target stream or repository workspace to compare and try again.")
+		compareDefaults()
+		return
+	}
+	source := flag.Arg(0)
+	target := flag.Arg(1)
+
+	if *projectName == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+
+		metadata := newMetaData()
+		err = metadata.load(filepath.Join(findSandbox(cwd), metadataFileName))
+		if err != nil || metadata.projectName == "" {
+			panic(simpleWarning("Provide the project with the -project option or run the command from a sandbox."))
+		}
+		projectName = &metadata.projectName
+	}
+
+	// You don't need credentials to compare streams of public projects
+	userId := ""
+	password := ""
+	if isLoggedIn() {
+		var err error
+		userId, password, err = getCredentials()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	client, err := NewClient(userId, password)
+	if err != nil {
+		panic(err)
+	}
+
+	project, err := client.findProject(*projectName)
+	if err != nil {
+		panic(err)
+	}
+	ccmBaseUrl := project.CcmBaseUrl
+
+	sourceId := findConfiguration(client, ccmBaseUrl, *projectName, source, userId != "")
+	targetId := findConfiguration(client, ccmBaseUrl, *projectName, target, userId != "")
+
+	emit(Event{Type: EVENT_PHASE_STARTED, Phase: "compare", Message: fmt.Sprintf("Comparing %v with %v...", source, target)})
+
+	changes := compareConfigurations(walkConfiguration(client, ccmBaseUrl, sourceId), walkConfiguration(client, ccmBaseUrl, targetId))
+
+	for _, change := range changes {
+		emit(Event{Type: EVENT_CHANGE, Phase: "compare", Path: change.path, From: change.from, Change: change.change})
+
+		if *showDiff && change.change == "Changed" && !change.target.file.info.Attributes.SymbolicLink {
+			emit(Event{Type: EVENT_DIFF, Phase: "compare", Path: change.path, Message: remoteDiff(change.source, change.target)})
+		}
+	}
+
+	message := fmt.Sprintf("%v differences", len(changes))
+	if len(changes) == 0 {
+		message = "No differences"
+	}
+	emit(Event{Type: EVENT_SUMMARY, Phase: "compare", Files: len(changes), Message: message})
+}
+
+// Find a stream of the project, or one of your repository workspaces, by name.
+// Item IDs are used as they are.
+func findConfiguration(client *Client, ccmBaseUrl string, projectName string, name string, loggedIn bool) string {
+	if strings.HasPrefix(name, "_") {
+		return name
+	}
+
+	streamId, err := FindStream(client, ccmBaseUrl, projectName, name)
+	if err != nil {
+		panic(err)
+	}
+	if streamId != "" {
+		return streamId
+	}
+
+	if loggedIn {
+		workspaceId, err := FindRepositoryWorkspace(client, ccmBaseUrl, name)
+		if err != nil {
+			panic(err)
+		}
+		if workspaceId != "" {
+			return workspaceId
+		}
+	}
+
+	panic(simpleWarning("Stream or repository workspace with name " + name + " not found"))
+}
+
+// Match the items of both configurations by their item ID. An item is moved
+// when it has a different name or parent folder, so the contents of a moved
+// folder aren't reported as moved themselves.
+func compareConfigurations(source []remoteEntry, target []remoteEntry) []comparison {
+	sourceItems := itemsById(source)
+	targetItems := itemsById(target)
+	sourceParents := parentIds(source)
+	targetParents := parentIds(target)
+
+	changes := []comparison{}
+
+	for i := range target {
+		t := &target[i]
+		s, ok := sourceItems[t.file.info.ScmInfo.ItemId]
+		if !ok {
+			changes = append(changes, comparison{change: "Added", path: t.path, target: t})
+			continue
+		}
+
+		if path.Base(s.path) != path.Base(t.path) || sourceParents[s.path] != targetParents[t.path] {
+			changes = append(changes, comparison{change: "Moved", path: t.path, from: s.path, source: s, target: t})
+		}
+
+		if !t.file.info.Directory && s.file.info.ScmInfo.StateId != t.file.info.ScmInfo.StateId {
+			changes = append(changes, comparison{change: "Changed", path: t.path, source: s, target: t})
+		}
+	}
+
+	for i := range source {
+		s := &source[i]
+		if _, ok := targetItems[s.file.info.ScmInfo.ItemId]; !ok {
+			changes = append(changes, comparison{change: "Removed", path: s.path, source: s})
+		}
+	}
+
+	sort.Sort(byComparisonPath(changes))
+
+	return changes
+}
+
+func itemsById(entries []remoteEntry) map[string]*remoteEntry {
+	items := make(map[string]*remoteEntry)
+	for i := range entries {
+		items[entries[i].file.info.ScmInfo.ItemId] = &entries[i]
+	}
+
+	return items
+}
+
+// The item ID of the parent folder of each path, empty for the root
+func parentIds(entries []remoteEntry) map[string]string {
+	byPath := make(map[string]string)
+	for _, entry := range entries {
+		byPath[entry.path] = entry.file.info.ScmInfo.ItemId
+	}
+
+	parents := make(map[string]string)
+	for _, entry := range entries {
+		parents[entry.path] = byPath[path.Dir(entry.path)]
+	}
+
+	return parents
+}
+
+// Download both versions of a file and render their differences
+func remoteDiff(source *remoteEntry, target *remoteEntry) string {
+	from := readRemote(source.file)
+	to := readRemote(target.file)
+
+	if isBinary(from) || isBinary(to) {
+		return fmt.Sprintf("Binary files a/%v and b/%v differ\n", source.path, target.path)
+	}
+
+	return unifiedDiff("a/"+source.path, "b/"+target.path, string(from), string(to))
+}
+
+func readRemote(file File) []byte {
+	downloadLimiter.acquire()
+	contents, err := ioutil.ReadAll(&file)
+	downloadLimiter.release(0, err)
+	file.Close()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return contents
+}
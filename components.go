@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Find the component by its name or item ID
+func findComponent(components []FileInfo, nameOrId string) (FileInfo, error) {
+	found := []FileInfo{}
+	for _, component := range components {
+		if component.Name == nameOrId || component.ScmInfo.ItemId == nameOrId {
+			found = append(found, component)
+		}
+	}
+
+	if len(found) == 0 {
+		return FileInfo{}, simpleWarning("There is no component " + nameOrId + " in the repository workspace.")
+	} else if len(found) > 1 {
+		return FileInfo{}, simpleWarning("There are several components named " + nameOrId + ", use the ID of the component instead.")
+	}
+
+	return found[0], nil
+}
+
+// Picks the component for new items whose parent folders aren't in any component
+// yet. The component of the checkin comes first, then the component mapped to
+// the longest prefix of the path in the sandbox, then the only component of
+// the workspace or the only one that is named as the default.
+type componentChooser struct {
+	components []FileInfo
+	chosen     string
+	rules      map[string]string
+}
+
+func newComponentChooser(components []FileInfo, metadata *metaData, nameOrId string) *componentChooser {
+	if len(components) == 0 {
+		panic(simpleWarning("There are no components in your repository workspace."))
+	}
+
+	chooser := &componentChooser{components: components, rules: metadata.componentRules}
+
+	if nameOrId != "" {
+		component, err := findComponent(components, nameOrId)
+		if err != nil {
+			panic(err)
+		}
+		chooser.chosen = component.ScmInfo.ItemId
+	}
+
+	return chooser
+}
+
+func (chooser *componentChooser) choose(rel string) (string, error) {
+	if chooser.chosen != "" {
+		return chooser.chosen, nil
+	}
+
+	prefix := ""
+	for p, _ := range chooser.rules {
+		if isWithin(rel, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix != "" {
+		componentId := chooser.rules[prefix]
+		for _, component := range chooser.components {
+			if component.ScmInfo.ItemId == componentId {
+				return componentId, nil
+			}
+		}
+		return "", simpleWarning(fmt.Sprintf("The component mapped to %v is no longer in the repository workspace. Map it to another component with 'gojazz component map'.", prefix))
+	}
+
+	if len(chooser.components) == 1 {
+		return chooser.components[0].ScmInfo.ItemId, nil
+	}
+
+	defaults := []string{}
+	for _, component := range chooser.components {
+		if strings.HasSuffix(component.Name, "Default Component") {
+			defaults = append(defaults, component.ScmInfo.ItemId)
+		}
+	}
+	if len(defaults) == 1 {
+		return defaults[0], nil
+	}
+
+	return "", simpleWarning(fmt.Sprintf("Cannot tell which component %v belongs to. Check it in with the -component option or map the path to a component with 'gojazz component map'.", rel))
+}
+
+func componentDefaults() {
+	fmt.Printf("gojazz component list [options]\n")
+	fmt.Printf("gojazz component map [options] <path> <component>\n")
+	fmt.Printf("gojazz component unmap [options] <path>\n")
+	flag.PrintDefaults()
+}
+
+// Show the components of the repository workspace and manage the mapping of
+// new folders in the sandbox to them
+func componentOp() {
+	if len(os.Args) < 2 {
+		componentDefaults()
+		return
+	}
+	command := os.Args[1]
+	os.Args = os.Args[1:]
+
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	flag.Usage = componentDefaults
+	flag.Parse()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if *sandboxPath == "" {
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+
+	metadataFile := filepath.Join(*sandboxPath, metadataFileName)
+	metadata := newMetaData()
+	err = metadata.load(metadataFile)
+	if err != nil {
+		panic(simpleWarning("Not a sandbox"))
+	}
+	if metadata.componentRules == nil {
+		metadata.componentRules = make(map[string]string)
+	}
+
+	switch command {
+	case "list":
+		client := sandboxClient(metadata)
+		components, err := FindComponents(client, metadata.ccmBaseUrl, metadata.workspaceId)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, component := range components {
+			prefixes := []string{}
+			for p, componentId := range metadata.componentRules {
+				if componentId == component.ScmInfo.ItemId {
+					prefixes = append(prefixes, filepath.ToSlash(p))
+				}
+			}
+			sort.Strings(prefixes)
+
+			if len(prefixes) > 0 {
+				emitMessage("%v (%v) <- %v", component.Name, component.ScmInfo.ItemId, strings.Join(prefixes, ", "))
+			} else {
+				emitMessage("%v (%v)", component.Name, component.ScmInfo.ItemId)
+			}
+		}
+		return
+	case "map":
+		if flag.NArg() != 2 {
+			emitWarning("Provide the path and the component and try again.")
+			componentDefaults()
+			return
+		}
+
+		rel := sandboxPaths(*sandboxPath, cwd, flag.Args()[:1])[0]
+		if rel == "." {
+			panic(simpleWarning("Map folders of the sandbox, use the -component option of checkin for the whole sandbox."))
+		}
+
+		client := sandboxClient(metadata)
+		components, err := FindComponents(client, metadata.ccmBaseUrl, metadata.workspaceId)
+		if err != nil {
+			panic(err)
+		}
+		component, err := findComponent(components, flag.Arg(1))
+		if err != nil {
+			panic(err)
+		}
+
+		metadata.componentRules[rel] = component.ScmInfo.ItemId
+		emitMessage("New items in %v are checked in to %v", filepath.ToSlash(rel), component.Name)
+	case "unmap":
+		if flag.NArg() != 1 {
+			emitWarning("Provide the path and try again.")
+			componentDefaults()
+			return
+		}
+
+		rel := sandboxPaths(*sandboxPath, cwd, flag.Args())[0]
+		if _, ok := metadata.componentRules[rel]; !ok {
+			panic(simpleWarning(filepath.ToSlash(rel) + " is not mapped to a component."))
+		}
+		delete(metadata.componentRules, rel)
+	default:
+		componentDefaults()
+		return
+	}
+
+	err = metadata.save(metadataFile)
+	if err != nil {
+		panic(err)
+	}
+}
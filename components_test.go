@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestComponentChooser(t *testing.T) {
+	components := []FileInfo{
+		{Name: "Web UI", ScmInfo: ScmInfo{ItemId: "web"}},
+		{Name: "Server", ScmInfo: ScmInfo{ItemId: "server"}},
+	}
+
+	md := newMetaData()
+	md.componentRules[filepath.FromSlash("client")] = "web"
+	md.componentRules[filepath.FromSlash("client/api")] = "server"
+
+	chooser := newComponentChooser(components, md, "")
+	for rel, expected := range map[string]string{"client/app.js": "web", "client/api/rest.go": "server"} {
+		componentId, err := chooser.choose(filepath.FromSlash(rel))
+		if err != nil || componentId != expected {
+			t.Errorf("Expected %v in %v, got %v %v", rel, expected, componentId, err)
+		}
+	}
+
+	// Without a mapping there is no way to tell
+	_, err := chooser.choose("tools")
+	if err == nil {
+		t.Error("Expected new items outside of the mapped folders to be ambiguous")
+	}
+
+	componentId, err := newComponentChooser(components, md, "Server").choose("tools")
+	if err != nil || componentId != "server" {
+		t.Errorf("Expected the component of the checkin to be chosen, got %v %v", componentId, err)
+	}
+
+	components = append(components, FileInfo{Name: "Project Default Component", ScmInfo: ScmInfo{ItemId: "default"}})
+	componentId, err = newComponentChooser(components, md, "").choose("tools")
+	if err != nil || componentId != "default" {
+		t.Errorf("Expected the default component to be chosen, got %v %v", componentId, err)
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// Lines of context around the changes of a unified diff
+	diffContext = 3
+	// Beyond this many edits the lines are simply all replaced
+	maxDiffEdits = 2000
+)
+
+func diffDefaults() {
+	fmt.Printf("gojazz diff [options] [paths...]\n")
+	flag.PrintDefaults()
+}
+
+// A changed file in the sandbox. The from path is where the file was loaded,
+// it is empty for added files. The path is empty for deleted files.
+type localChange struct {
+	path string
+	from string
+}
+
+type byChangePath []localChange
+
+func (a byChangePath) Len() int      { return len(a) }
+func (a byChangePath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byChangePath) Less(i, j int) bool {
+	return a[i].displayPath() < a[j].displayPath()
+}
+
+func (change localChange) displayPath() string {
+	if change.path == "" {
+		return change.from
+	}
+	return change.path
+}
+
+// Number of lines added and removed in a file for the -stat option
+type diffStat struct {
+	path       string
+	insertions int
+	deletions  int
+	binary     bool
+}
+
+func diffOp() {
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	stat := flag.Bool("stat", false, "Only show how many lines were added and removed in each file")
+	tool := flag.String("tool", "", "External program to compare each file with (e.g. meld). It gets the loaded version and the local file.")
+	transfer := transferFlags()
+	flag.Usage = diffDefaults
+	flag.Parse()
+	transfer.apply()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if *sandboxPath == "" {
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+
+	filters := sandboxPaths(*sandboxPath, cwd, flag.Args())
+
+	status, err := scmStatus(*sandboxPath, NO_COPY)
+	if err != nil {
+		panic(err)
+	}
+
+	changes := status.changedFiles(filters)
+	base := &baseReader{metadata: status.metaData, pristine: status.metaData.pristineStore(*sandboxPath)}
+	stats := []diffStat{}
+
+	for _, change := range changes {
+		from, hasBase := []byte{}, change.from != ""
+		if hasBase {
+			meta := status.metaData.pathMap[change.from]
+			from = base.read(meta, change.from)
+		}
+
+		to, hasLocal := []byte{}, change.path != ""
+		if hasLocal {
+			to = readLocal(filepath.Join(*sandboxPath, change.path), status.metaData.eolStyleFor(change.path))
+		}
+
+		fromName := "/dev/null"
+		if hasBase {
+			fromName = "a/" + filepath.ToSlash(change.from)
+		}
+		toName := "/dev/null"
+		if hasLocal {
+			toName = "b/" + filepath.ToSlash(change.path)
+		}
+
+		switch {
+		case *tool != "":
+			err = runDiffTool(*tool, from, *sandboxPath, change, status.metaData.eolStyleFor(change.displayPath()))
+			if err != nil {
+				panic(err)
+			}
+		case *stat:
+			s := diffStat{path: filepath.ToSlash(change.displayPath()), binary: isBinary(from) || isBinary(to)}
+			if change.from != "" && change.path != "" && change.from != change.path {
+				s.path = filepath.ToSlash(change.from) + " => " + filepath.ToSlash(change.path)
+			}
+			if !s.binary {
+				for _, edit := range diffLines(splitLines(string(from)), splitLines(string(to))) {
+					if edit.kind == '+' {
+						s.insertions++
+					} else if edit.kind == '-' {
+						s.deletions++
+					}
+				}
+			}
+			stats = append(stats, s)
+		case isBinary(from) || isBinary(to):
+			emit(Event{Type: EVENT_DIFF, Phase: "diff", Path: change.displayPath(), Message: fmt.Sprintf("Binary files %v and %v differ\n", fromName, toName)})
+		default:
+			emit(Event{Type: EVENT_DIFF, Phase: "diff", Path: change.displayPath(), Message: unifiedDiff(fromName, toName, string(from), string(to))})
+		}
+	}
+
+	if *stat {
+		emitStats(stats)
+		return
+	}
+
+	summary := Event{Type: EVENT_SUMMARY, Phase: "diff", Path: *sandboxPath, Files: len(changes)}
+	if len(changes) == 0 {
+		summary.Message = "No local changes"
+	}
+	emit(summary)
+}
+
+// The changed files of the status, sorted and limited to the files inside
+// of the filters. Folders don't have contents to compare.
+func (status *status) changedFiles(filters []string) []localChange {
+	changes := []localChange{}
+
+	isFile := func(meta metaObject) bool {
+		return meta.Hash != "" || meta.LinkTarget != ""
+	}
+
+	for p, _ := range status.Added {
+		info, err := os.Lstat(filepath.Join(status.sandboxPath, p))
+		if err == nil && (!info.IsDir() || isSymlink(info)) {
+			changes = append(changes, localChange{path: p})
+		}
+	}
+	for p, _ := range status.Modified {
+		from := p
+		if moved, ok := status.Moved[p]; ok {
+			from = moved
+		}
+		if isFile(status.metaData.pathMap[from]) {
+			changes = append(changes, localChange{path: p, from: from})
+		}
+	}
+	for p, _ := range status.Deleted {
+		if isFile(status.metaData.pathMap[p]) {
+			changes = append(changes, localChange{from: p})
+		}
+	}
+
+	if len(filters) > 0 {
+		filtered := []localChange{}
+		for _, change := range changes {
+			if (change.path != "" && withinAny(change.path, filters)) || (change.from != "" && withinAny(change.from, filters)) {
+				filtered = append(filtered, change)
+			}
+		}
+		changes = filtered
+	}
+
+	sort.Sort(byChangePath(changes))
+
+	return changes
+}
+
+// The paths of the arguments relative to the sandbox. Relative arguments are
+// relative to the current directory.
+func sandboxPaths(sandboxPath string, cwd string, args []string) []string {
+	paths := []string{}
+
+	for _, arg := range args {
+		abs := arg
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(cwd, arg)
+		}
+
+		rel, err := filepath.Rel(sandboxPath, abs)
+		if err != nil || (rel != "." && !inSandbox(rel)) {
+			panic(simpleWarning(arg + " is not inside the sandbox at " + sandboxPath))
+		}
+		paths = append(paths, rel)
+	}
+
+	return paths
+}
+
+// Check whether the path is one of the paths or inside of one of them
+func withinAny(rel string, paths []string) bool {
+	for _, p := range paths {
+		if p == "." || isWithin(rel, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The local contents in the form they are stored in the repository. Links are
+// compared by their targets.
+func readLocal(path string, eol eolStyle) []byte {
+	info, err := os.Lstat(path)
+	if err != nil {
+		panic(err)
+	}
+
+	if isSymlink(info) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			panic(err)
+		}
+		return []byte(filepath.ToSlash(target))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(normalizeEol(file, eol))
+	if err != nil {
+		panic(err)
+	}
+
+	return contents
+}
+
+// Reads the loaded versions of files. They come from the pristine store or the
+// cache when possible, otherwise from the repository by their item and state IDs.
+type baseReader struct {
+	metadata *metaData
+	pristine *pristineStore
+	client   *Client
+}
+
+func (reader *baseReader) read(meta metaObject, rel string) []byte {
+	if meta.LinkTarget != "" {
+		return []byte(meta.LinkTarget)
+	}
+
+	if reader.pristine != nil {
+		if contents, ok := reader.pristine.read(meta.Hash); ok {
+			return contents
+		}
+	}
+
+	if _, objectPath, ok := cachedContents(ScmInfo{ItemId: meta.ItemId, StateId: meta.StateId}); ok {
+		contents, err := ioutil.ReadFile(objectPath)
+		if err == nil {
+			return contents
+		}
+	}
+
+	client := reader.connect()
+	ccmBaseUrl := reader.metadata.ccmBaseUrl
+
+	// The repository workspace usually still has the loaded version
+	file, err := Open(client, ccmBaseUrl, reader.metadata.workspaceId, meta.ComponentId, filepath.ToSlash(rel))
+	if err == nil && file.info.ScmInfo.ItemId == meta.ItemId && file.info.ScmInfo.StateId == meta.StateId {
+		return readRemote(*file)
+	}
+
+	downloadLimiter.acquire()
+	version, err := OpenVersion(client, ccmBaseUrl, meta.ComponentId, meta.ItemId, meta.StateId)
+	contents := []byte{}
+	if err == nil {
+		contents, err = ioutil.ReadAll(version)
+		version.Close()
+	}
+	downloadLimiter.release(0, err)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return contents
+}
+
+func (reader *baseReader) connect() *Client {
+	if reader.client == nil {
+		reader.client = sandboxClient(reader.metadata)
+	}
+
+	return reader.client
+}
+
+// Run the external diff tool with a copy of the loaded version and the local
+// file, so that changes made with the tool end up in the sandbox.
+func runDiffTool(tool string, base []byte, sandboxPath string, change localChange, eol eolStyle) error {
+	tempDir, err := ioutil.TempDir("", "gojazz-diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	name := filepath.Base(change.displayPath())
+
+	basePath := filepath.Join(tempDir, "loaded-"+name)
+	localized, err := ioutil.ReadAll(localizeEol(bytes.NewReader(base), eol))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(basePath, localized, 0600)
+	if err != nil {
+		return err
+	}
+
+	localPath := filepath.Join(tempDir, "deleted-"+name)
+	if change.path != "" {
+		localPath = filepath.Join(sandboxPath, change.path)
+	} else {
+		err = ioutil.WriteFile(localPath, []byte{}, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := strings.Fields(tool)
+	cmd := exec.Command(args[0], append(args[1:], basePath, localPath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+
+	// Diff tools exit with an error code when the files are different
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+
+	return err
+}
+
+// Print the lines added and removed for each file with a histogram that fits
+// into a terminal, followed by the totals
+func emitStats(stats []diffStat) {
+	const maxBar = 50
+
+	width := 0
+	largest := 0
+	insertions := 0
+	deletions := 0
+	for _, s := range stats {
+		if len(s.path) > width {
+			width = len(s.path)
+		}
+		if s.insertions+s.deletions > largest {
+			largest = s.insertions + s.deletions
+		}
+		insertions += s.insertions
+		deletions += s.deletions
+	}
+
+	for _, s := range stats {
+		line := ""
+		if s.binary {
+			line = fmt.Sprintf(" %-*v | Bin\n", width, s.path)
+		} else {
+			plus := s.insertions
+			minus := s.deletions
+			if largest > maxBar {
+				plus = (plus*maxBar + largest - 1) / largest
+				minus = (minus*maxBar + largest - 1) / largest
+			}
+			line = fmt.Sprintf(" %-*v | %5v %v%v\n", width, s.path, s.insertions+s.deletions, strings.Repeat("+", plus), strings.Repeat("-", minus))
+		}
+
+		emit(Event{Type: EVENT_DIFF, Phase: "diff", Path: s.path, Message: line})
+	}
+
+	emit(Event{Type: EVENT_SUMMARY, Phase: "diff", Files: len(stats), Message: fmt.Sprintf("%v files changed, %v insertions(+), %v deletions(-)", len(stats), insertions, deletions)})
+}
+
+type diffEdit struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Check whether the contents look binary, the same way as the line delimiter conversion
+func isBinary(contents []byte) bool {
+	if len(contents) > binaryProbeSize {
+		contents = contents[:binaryProbeSize]
+	}
+
+	return bytes.IndexByte(contents, 0) != -1
+}
+
+// Split the contents into lines, keeping the line delimiters
+func splitLines(contents string) []string {
+	lines := strings.SplitAfter(contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Compute the edits that turn the lines of a into the lines of b
+func diffLines(a []string, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := []diffEdit{}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffEdit{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffEdit{' ', line})
+	}
+
+	return ops
+}
+
+// Myers' algorithm for the shortest edit script. Each step of the trace only
+// keeps the diagonals that were reachable at that point.
+func myersDiff(a []string, b []string) []diffEdit {
+	n := len(a)
+	m := len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			// Not worth finding the smallest set of changes
+			ops := []diffEdit{}
+			for _, line := range a {
+				ops = append(ops, diffEdit{'-', line})
+			}
+			for _, line := range b {
+				ops = append(ops, diffEdit{'+', line})
+			}
+			return ops
+		}
+
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return myersBacktrack(a, b, trace)
+			}
+		}
+	}
+
+	return []diffEdit{}
+}
+
+func myersBacktrack(a []string, b []string, trace [][]int) []diffEdit {
+	x := len(a)
+	y := len(b)
+	reversed := []diffEdit{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		// The diagonals of step d are stored from -d-1 onwards
+		at := func(k int) int {
+			return v[k+d+1]
+		}
+
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffEdit{' ', a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffEdit{'+', b[y-1]})
+			} else {
+				reversed = append(reversed, diffEdit{'-', a[x-1]})
+			}
+		}
+
+		x = prevX
+		y = prevY
+	}
+
+	ops := make([]diffEdit, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+
+	return ops
+}
+
+// Render the differences between the contents as a unified diff. It is empty
+// when the contents are the same.
+func unifiedDiff(fromName string, toName string, from string, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	// Line numbers in both files before each of the edits
+	fromLine := make([]int, len(ops)+1)
+	toLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		fromLine[i+1] = fromLine[i]
+		toLine[i+1] = toLine[i]
+		if op.kind != '+' {
+			fromLine[i+1]++
+		}
+		if op.kind != '-' {
+			toLine[i+1]++
+		}
+	}
+
+	out := &bytes.Buffer{}
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+
+		// Changes that are close together share a hunk
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*diffContext {
+				end = next
+				continue
+			}
+
+			end += diffContext
+			if end > len(ops) {
+				end = len(ops)
+			}
+			break
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(out, "--- %v\n+++ %v\n", fromName, toName)
+		}
+		fmt.Fprintf(out, "@@ -%v +%v @@\n", hunkRange(fromLine[start], fromLine[end]), hunkRange(toLine[start], toLine[end]))
+
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return out.String()
+}
+
+func hunkRange(start int, end int) string {
+	count := end - start
+	if count == 0 {
+		return fmt.Sprintf("%v,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%v", start+1)
+	}
+
+	return fmt.Sprintf("%v,%v", start+1, count)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	to := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+
+	expected := "--- a/file\n+++ b/file\n" +
+		"@@ -1,7 +1,7 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n" +
+		"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n\\ No newline at end of file\n"
+
+	diff := unifiedDiff("a/file", "b/file", from, to)
+	if diff != expected {
+		t.Errorf("Unexpected diff:\n%v", diff)
+	}
+
+	if unifiedDiff("a/file", "b/file", from, from) != "" {
+		t.Error("Identical contents should have an empty diff")
+	}
+}
+
+func TestDiffLinesRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"a\n", "b\n", "c\n", "d\n"}
+
+	for i := 0; i < 200; i++ {
+		a := []string{}
+		b := []string{}
+		for j := random.Intn(20); j > 0; j-- {
+			a = append(a, words[random.Intn(len(words))])
+		}
+		for j := random.Intn(20); j > 0; j-- {
+			b = append(b, words[random.Intn(len(words))])
+		}
+
+		from := []string{}
+		to := []string{}
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				from = append(from, op.line)
+			}
+			if op.kind != '-' {
+				to = append(to, op.line)
+			}
+		}
+
+		if strings.Join(from, "") != strings.Join(a, "") || strings.Join(to, "") != strings.Join(b, "") {
+			t.Fatalf("The edits don't turn %q into %q", a, b)
+		}
+	}
+}
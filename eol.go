@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type eolStyle int
+
+// Number of bytes to look at to decide whether a file is binary
+const binaryProbeSize = 8000
+
+const (
+	EOL_NONE eolStyle = iota
+	EOL_LF
+	EOL_CRLF
+	EOL_AUTO
+)
+
+// A line delimiter rule for the sandbox. Rules are applied in order and the
+// last rule that matches a path wins.
+type eolRule struct {
+	Pattern string
+	Style   string
+}
+
+func parseEolStyle(s string) (eolStyle, bool) {
+	switch strings.ToLower(s) {
+	case "none", "binary":
+		return EOL_NONE, true
+	case "lf":
+		return EOL_LF, true
+	case "crlf":
+		return EOL_CRLF, true
+	case "auto", "native":
+		return EOL_AUTO, true
+	}
+
+	return EOL_NONE, false
+}
+
+// Parse a comma separated list of line delimiter rules of the form
+// "auto,*.sh=lf,*.bat=crlf". A style without a pattern applies to
+// every file in the sandbox.
+func parseEolRules(spec string) ([]eolRule, error) {
+	rules := []eolRule{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern := "*"
+		style := entry
+		if idx := strings.LastIndex(entry, "="); idx != -1 {
+			pattern = strings.TrimSpace(entry[:idx])
+			style = strings.TrimSpace(entry[idx+1:])
+		}
+
+		if _, ok := parseEolStyle(style); !ok {
+			return nil, simpleWarning("Unknown line delimiter style '" + style + "'. Use one of lf, crlf, auto or none.")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, simpleWarning("Invalid line delimiter pattern '" + pattern + "'")
+		}
+
+		rules = append(rules, eolRule{Pattern: pattern, Style: strings.ToLower(style)})
+	}
+
+	return rules, nil
+}
+
+func (rule eolRule) matches(relpath string) bool {
+	relpath = filepath.ToSlash(relpath)
+
+	// Patterns without a slash match the file name anywhere in the sandbox
+	if !strings.Contains(rule.Pattern, "/") {
+		matched, _ := path.Match(rule.Pattern, path.Base(relpath))
+		return matched
+	}
+
+	matched, _ := path.Match(strings.TrimPrefix(rule.Pattern, "/"), relpath)
+	return matched
+}
+
+// Find the line delimiter style for a path relative to the sandbox.
+// The 'auto' style is resolved to the style of the current platform.
+func (metadata *metaData) eolStyleFor(relpath string) eolStyle {
+	style := EOL_NONE
+
+	for _, rule := range metadata.eolRules {
+		if rule.matches(relpath) {
+			style, _ = parseEolStyle(rule.Style)
+		}
+	}
+
+	if style == EOL_AUTO {
+		if runtime.GOOS == "windows" {
+			return EOL_CRLF
+		}
+		return EOL_LF
+	}
+
+	return style
+}
+
+// Convert the contents into the form stored in the repository (LF line delimiters)
+func normalizeEol(r io.Reader, style eolStyle) io.Reader {
+	if style == EOL_NONE {
+		return r
+	}
+
+	return newEolConverter(r, false)
+}
+
+// Convert the contents into the form that is written to the sandbox
+func localizeEol(r io.Reader, style eolStyle) io.Reader {
+	if style == EOL_NONE {
+		return r
+	}
+
+	return newEolConverter(r, style == EOL_CRLF)
+}
+
+// Streaming line delimiter converter. Every CRLF and LF in the source is
+// written as either LF or CRLF. Content that looks binary is passed
+// through untouched.
+type eolConverter struct {
+	src     *bufio.Reader
+	crlf    bool
+	binary  bool
+	pending bool
+}
+
+func newEolConverter(r io.Reader, crlf bool) *eolConverter {
+	src := bufio.NewReaderSize(r, binaryProbeSize)
+	head, _ := src.Peek(binaryProbeSize)
+
+	return &eolConverter{src: src, crlf: crlf, binary: bytes.IndexByte(head, 0) != -1}
+}
+
+func (c *eolConverter) Read(p []byte) (int, error) {
+	if c.binary {
+		return c.src.Read(p)
+	}
+
+	n := 0
+	for n < len(p) {
+		// The LF from a CRLF that didn't fit in the last read
+		if c.pending {
+			p[n] = '\n'
+			n++
+			c.pending = false
+			continue
+		}
+
+		b, err := c.src.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if b == '\r' {
+			next, err := c.src.Peek(1)
+			if err == nil && next[0] == '\n' {
+				// The LF that follows will produce the right delimiter
+				continue
+			}
+		}
+
+		if b == '\n' && c.crlf {
+			p[n] = '\r'
+			n++
+			c.pending = true
+			continue
+		}
+
+		p[n] = b
+		n++
+	}
+
+	return n, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEolConversion(t *testing.T) {
+	rules, err := parseEolRules("lf,*.bat=crlf,scripts/*.txt=none")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	md := newMetaData()
+	md.eolRules = rules
+
+	if md.eolStyleFor("src/main.go") != EOL_LF {
+		t.Errorf("Expected LF for a regular file")
+	}
+	if md.eolStyleFor("tools/build.bat") != EOL_CRLF {
+		t.Errorf("Expected CRLF for a batch file")
+	}
+	if md.eolStyleFor("scripts/notes.txt") != EOL_NONE {
+		t.Errorf("Expected no conversion for an anchored pattern")
+	}
+
+	contents := "line1\r\nline2\nline3\r"
+
+	b, _ := ioutil.ReadAll(normalizeEol(strings.NewReader(contents), EOL_CRLF))
+	if string(b) != "line1\nline2\nline3\r" {
+		t.Errorf("Unexpected normalized contents: %q", string(b))
+	}
+
+	b, _ = ioutil.ReadAll(localizeEol(strings.NewReader(contents), EOL_CRLF))
+	if string(b) != "line1\r\nline2\r\nline3\r" {
+		t.Errorf("Unexpected local contents: %q", string(b))
+	}
+
+	binary := "bin\x00ary\r\n"
+	b, _ = ioutil.ReadAll(normalizeEol(strings.NewReader(binary), EOL_LF))
+	if string(b) != binary {
+		t.Errorf("Binary contents should not be converted: %q", string(b))
+	}
+}
+
+func TestEolZeroValue(t *testing.T) {
+	var eol eolStyle
+	if eol != EOL_NONE {
+		t.Errorf("The zero line delimiter style should be none: %v", eol)
+	}
+
+	contents := "line1\r\nline2\n"
+	b, _ := ioutil.ReadAll(localizeEol(strings.NewReader(contents), eol))
+	if string(b) != contents {
+		t.Errorf("The zero style should not convert: %q", string(b))
+	}
+	b, _ = ioutil.ReadAll(normalizeEol(strings.NewReader(contents), eol))
+	if string(b) != contents {
+		t.Errorf("The zero style should not normalize: %q", string(b))
+	}
+
+	if md := newMetaData(); md.eolStyleFor("src/main.go") != EOL_NONE {
+		t.Errorf("A sandbox without rules should not convert line delimiters")
+	}
+}
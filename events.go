@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EVENT_MESSAGE         = "message"
+	EVENT_WARNING         = "warning"
+	EVENT_ERROR           = "error"
+	EVENT_PHASE_STARTED   = "phaseStarted"
+	EVENT_PHASE_FINISHED  = "phaseFinished"
+	EVENT_PROGRESS        = "progress"
+	EVENT_FILE_DOWNLOADED = "fileDownloaded"
+	EVENT_FILE_CHECKED_IN = "fileCheckedIn"
+	EVENT_CHANGE          = "change"
+	EVENT_DIFF            = "diff"
+	EVENT_SUMMARY         = "summary"
+)
+
+// Something that happened during an operation. Events are rendered either for
+// humans or as newline-delimited JSON for tools.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Phase   string    `json:"phase,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	From    string    `json:"from,omitempty"`
+	Change  string    `json:"change,omitempty"`
+	Files   int       `json:"files,omitempty"`
+	Total   int       `json:"total,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Url     string    `json:"url,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+type eventRenderer interface {
+	render(e Event)
+}
+
+var (
+	renderer      eventRenderer = &humanRenderer{out: os.Stdout}
+	rendererMutex               = &sync.Mutex{}
+)
+
+// Choose how events are rendered, either "text" or "json"
+func setOutput(output string) {
+	rendererMutex.Lock()
+	defer rendererMutex.Unlock()
+
+	switch output {
+	case "text":
+		renderer = &humanRenderer{out: os.Stdout}
+	case "json":
+		renderer = &jsonRenderer{encoder: json.NewEncoder(os.Stdout)}
+	default:
+		panic(simpleWarning("Unknown output '" + output + "'. Use either text or json."))
+	}
+}
+
+// Keep stdout free for other output (e.g. an archive) by writing the regular
+// console output to stderr. Events in JSON can't be moved.
+func reserveStdout() {
+	rendererMutex.Lock()
+	defer rendererMutex.Unlock()
+
+	human, ok := renderer.(*humanRenderer)
+	if !ok {
+		panic(simpleWarning("Standard output is already used for the JSON output."))
+	}
+	human.out = os.Stderr
+}
+
+func jsonOutput() bool {
+	rendererMutex.Lock()
+	defer rendererMutex.Unlock()
+
+	_, ok := renderer.(*jsonRenderer)
+	return ok
+}
+
+func emit(e Event) {
+	e.Time = time.Now()
+
+	rendererMutex.Lock()
+	defer rendererMutex.Unlock()
+
+	renderer.render(e)
+}
+
+func emitMessage(format string, a ...interface{}) {
+	emit(Event{Type: EVENT_MESSAGE, Message: strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")})
+}
+
+func emitWarning(format string, a ...interface{}) {
+	emit(Event{Type: EVENT_WARNING, Message: strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")})
+}
+
+// Renders the events as the regular console output
+type humanRenderer struct {
+	out                io.Writer
+	lastProgressLength int
+}
+
+func (r *humanRenderer) render(e Event) {
+	switch e.Type {
+	case EVENT_PROGRESS:
+		// Backspace and space out the last line that was printed
+		for i := 0; i < r.lastProgressLength; i++ {
+			fmt.Fprintf(r.out, "\b")
+		}
+		for i := 0; i < r.lastProgressLength; i++ {
+			fmt.Fprintf(r.out, " ")
+		}
+		for i := 0; i < r.lastProgressLength; i++ {
+			fmt.Fprintf(r.out, "\b")
+		}
+
+		verb := "Loaded"
+		if e.Phase == "export" {
+			verb = "Exported"
+		}
+		r.lastProgressLength, _ = fmt.Fprintf(r.out, "%v %v (of %v) files. %v", verb, e.Files, e.Total, formatBytes(e.Bytes))
+		return
+	case EVENT_FILE_DOWNLOADED:
+		return
+	case EVENT_FILE_CHECKED_IN, EVENT_CHANGE:
+		if e.From != "" {
+			fmt.Fprintf(r.out, "%v -> %v (%v)\n", e.From, e.Path, e.Change)
+		} else {
+			fmt.Fprintf(r.out, "%v (%v)\n", e.Path, e.Change)
+		}
+		return
+	case EVENT_DIFF:
+		fmt.Fprint(r.out, e.Message)
+		return
+	}
+
+	// Complete the line of the progress tracker
+	if r.lastProgressLength > 0 {
+		fmt.Fprintf(r.out, "\n")
+		r.lastProgressLength = 0
+	}
+
+	if e.Message != "" {
+		fmt.Fprintln(r.out, e.Message)
+	}
+	if e.Url != "" {
+		fmt.Fprintln(r.out, e.Url)
+	}
+}
+
+// Renders each event as a line of JSON
+type jsonRenderer struct {
+	encoder *json.Encoder
+}
+
+func (r *jsonRenderer) render(e Event) {
+	r.encoder.Encode(e)
+}
+
+func formatBytes(bytes int64) string {
+	// TODO handle Gigabytes?
+	if bytes > (1024 * 1024) {
+		return strconv.FormatInt(bytes/(1024*1024), 10) + "MB"
+	} else if bytes > 1024 {
+		return strconv.FormatInt(bytes/1024, 10) + "KB"
+	}
+
+	return strconv.FormatInt(bytes, 10) + "B"
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	manifestFileName = "gojazz-manifest.json"
+)
+
+func exportDefaults() {
+	fmt.Printf("gojazz export <project name> [options]\n")
+	flag.PrintDefaults()
+}
+
+// Records the exact versions of the files in an archive
+type exportManifest struct {
+	Project         string          `json:"project"`
+	Configuration   string          `json:"configuration"`
+	ConfigurationId string          `json:"configurationId"`
+	Exported        time.Time       `json:"exported"`
+	Files           []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path        string `json:"path"`
+	ComponentId string `json:"componentId"`
+	ItemId      string `json:"itemId"`
+	StateId     string `json:"stateId"`
+	Hash        string `json:"hash,omitempty"`
+	LinkTarget  string `json:"linkTarget,omitempty"`
+}
+
+// A remote file, folder or link of a configuration
+type remoteEntry struct {
+	path string
+	file File
+}
+
+type byRemotePath []remoteEntry
+
+func (a byRemotePath) Len() int           { return len(a) }
+func (a byRemotePath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byRemotePath) Less(i, j int) bool { return a[i].path < a[j].path }
+
+// The contents of a file fetched ahead of being written to the archive
+type exportedContents struct {
+	temp *os.File
+	size int64
+	hash string
+	err  error
+}
+
+func exportOp() {
+	projectName := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		projectName = os.Args[1]
+		os.Args = os.Args[1:]
+	}
+
+	stream := flag.String("stream", "", "Stream to export, the project's default stream when no other configuration is provided")
+	workspaceName := flag.String("workspace-name", "", "Export the repository workspace with this name")
+	workspaceItemId := flag.String("workspace-id", "", "Export the repository workspace with this item ID")
+	snapshotId := flag.String("snapshot-id", "", "Export the snapshot with this item ID")
+	baselineIds := flag.String("baseline", "", "Export the baselines with these item IDs, separated by commas (one for each component)")
+	fileName := flag.String("file", "", "Archive file to write, standard output when not provided")
+	format := flag.String("format", "", "Archive format: tar, tar.gz or zip. By default it comes from the file name, tar.gz for standard output.")
+	manifest := flag.Bool("manifest", false, "Add a "+manifestFileName+" file with the item and state IDs of every file")
+	prefix := flag.String("prefix", "", "Folder inside the archive for all of the files (e.g. myproject-1.0)")
+	transfer := transferFlags()
+	flag.Usage = exportDefaults
+	flag.Parse()
+	transfer.apply()
+
+	if projectName == "" {
+		emitWarning("Provide a project to export and try again.")
+		exportDefaults()
+		return
+	}
+
+	chosen := 0
+	for _, option := range []string{*stream, *workspaceName, *workspaceItemId, *snapshotId, *baselineIds} {
+		if option != "" {
+			chosen++
+		}
+	}
+	if chosen > 1 {
+		panic(simpleWarning("Choose only one of the -stream, -workspace-name, -workspace-id, -snapshot-id and -baseline options."))
+	}
+
+	archiveType, err := archiveFormat(*format, *fileName)
+	if err != nil {
+		panic(err)
+	}
+
+	toStdout := *fileName == "" || *fileName == "-"
+	if toStdout {
+		reserveStdout()
+	}
+
+	// You don't need credentials to export streams of public projects
+	userId := ""
+	password := ""
+	//  Snapshots and baselines are read through a temporary repository workspace.
+	if *workspaceName != "" || *workspaceItemId != "" || *snapshotId != "" || *baselineIds != "" || isLoggedIn() {
+		// The prompt for credentials would end up in the archive
+		if toStdout && !isLoggedIn() {
+			panic(simpleWarning("Use the login command to set your credentials before exporting to standard output."))
+		}
+
+		userId, password, err = getCredentials()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	client, err := NewClient(userId, password)
+	if err != nil {
+		panic(err)
+	}
+
+	project, err := client.findProject(projectName)
+	if err != nil {
+		panic(err)
+	}
+	ccmBaseUrl := project.CcmBaseUrl
+
+	configurationId := ""
+	configuration := ""
+	walkId := ""
+	switch {
+	case *workspaceItemId != "":
+		configurationId, _ = findWorkspaceById(client, ccmBaseUrl, *workspaceItemId)
+		configuration = "Repository Workspace " + *workspaceItemId
+	case *workspaceName != "":
+		configurationId, _ = findNamedWorkspace(client, ccmBaseUrl, projectName, *workspaceName)
+		configuration = "Repository Workspace " + *workspaceName
+	case *snapshotId != "":
+		configurationId = *snapshotId
+		configuration = "Snapshot " + *snapshotId
+
+		walkId, err = CreateWorkspaceFromSnapshot(client, ccmBaseUrl, configurationId, exportWorkspaceName(configuration))
+		if err != nil {
+			panic(err)
+		}
+		defer deleteExportWorkspace(client, ccmBaseUrl, walkId)
+	case *baselineIds != "":
+		ids := []string{}
+		for _, id := range strings.Split(*baselineIds, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		configurationId = strings.Join(ids, ",")
+		configuration = "Baseline " + configurationId
+
+		walkId, err = CreateWorkspaceFromBaselines(client, ccmBaseUrl, ids, exportWorkspaceName(configuration))
+		if err != nil {
+			panic(err)
+		}
+		defer deleteExportWorkspace(client, ccmBaseUrl, walkId)
+	default:
+		streamName := *stream
+		if streamName == "" {
+			streamName = projectName + " Stream"
+		}
+		configurationId, err = FindStream(client, ccmBaseUrl, projectName, streamName)
+		if err != nil {
+			panic(err)
+		}
+		if configurationId == "" {
+			panic(simpleWarning("Stream with name " + streamName + " not found"))
+		}
+		configuration = "Stream " + streamName
+	}
+
+	emit(Event{Type: EVENT_PHASE_STARTED, Phase: "export", Message: fmt.Sprintf("Exporting %v...", configuration)})
+
+	if walkId == "" {
+		walkId = configurationId
+	}
+	entries := walkConfiguration(client, ccmBaseUrl, walkId)
+
+	// The archive is written next to its final location and only moved there once it is complete
+	var out io.Writer = os.Stdout
+	var archiveFile *os.File
+	if !toStdout {
+		archiveFile, err = ioutil.TempFile(filepath.Dir(*fileName), ".gojazz-export")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(archiveFile.Name())
+		out = archiveFile
+	}
+
+	archive := newArchiveWriter(archiveType, out)
+	manifestEntries, bytes := writeExport(archive, entries, *prefix)
+
+	if *manifest {
+		m := exportManifest{Project: projectName, Configuration: configuration, ConfigurationId: configurationId, Exported: time.Now(), Files: manifestEntries}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		err = archive.addFile(path.Join(*prefix, manifestFileName), int64(len(b)), m.Exported, strings.NewReader(string(b)))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	if archiveFile != nil {
+		err = archiveFile.Close()
+		if err != nil {
+			panic(err)
+		}
+		err = os.Rename(archiveFile.Name(), *fileName)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	emit(Event{Type: EVENT_PHASE_FINISHED, Phase: "export", Path: *fileName, Files: len(manifestEntries), Bytes: bytes, Message: "Export Complete"})
+}
+
+func exportWorkspaceName(configuration string) string {
+	return fmt.Sprintf("gojazz export of %v %v", configuration, time.Now().Format(backupIdFormat))
+}
+
+// Remove the temporary repository workspace of the export, even when it failed
+func deleteExportWorkspace(client *Client, ccmBaseUrl string, workspaceId string) {
+	err := DeleteWorkspace(client, ccmBaseUrl, workspaceId)
+	if err != nil {
+		emitWarning("The temporary repository workspace %v could not be deleted: %v", workspaceId, err)
+	}
+}
+
+// Walk all of the components of the configuration and sort the entries so that
+// folders come before their contents.
+func walkConfiguration(client *Client, ccmBaseUrl string, configurationId string) []remoteEntry {
+	components, err := FindComponents(client, ccmBaseUrl, configurationId)
+	if err != nil {
+		panic(err)
+	}
+
+	entries := []remoteEntry{}
+	seen := make(map[string]bool)
+	mutex := &sync.Mutex{}
+
+	for _, component := range components {
+		err = Walk(client, ccmBaseUrl, configurationId, component.ScmInfo.ItemId, newMetaData(), func(p string, file File) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			// Components share the root of the sandbox, the first one wins
+			if seen[p] {
+				if !file.info.Directory {
+					emitWarning("Skipping %v from component %v, another component has the same path.", p, component.Name)
+				}
+				return nil
+			}
+			seen[p] = true
+
+			entries = append(entries, remoteEntry{path: p, file: file})
+			return nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	sort.Sort(byRemotePath(entries))
+
+	return entries
+}
+
+// Write the entries to the archive while the contents of the upcoming files are
+// downloaded in the background.
+func writeExport(archive archiveWriter, entries []remoteEntry, prefix string) ([]manifestEntry, int64) {
+	tempDir, err := ioutil.TempDir("", "gojazz-export")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	numFiles := 0
+	results := make([]chan exportedContents, len(entries))
+	for i, entry := range entries {
+		if !entry.file.info.Directory && !entry.file.info.Attributes.SymbolicLink {
+			results[i] = make(chan exportedContents, 1)
+			numFiles++
+		}
+	}
+
+	// Limit how far the downloads get ahead of the archive
+	numWorkers := downloadLimiter.workers()
+	ahead := make(chan bool, 2*numWorkers)
+	queue := make(chan int)
+
+	go func() {
+		for i := range entries {
+			if results[i] != nil {
+				ahead <- true
+				queue <- i
+			}
+		}
+		close(queue)
+	}()
+
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			for i := range queue {
+				results[i] <- fetchExportContents(entries[i].file, tempDir)
+			}
+		}()
+	}
+
+	manifestEntries := []manifestEntry{}
+	exported := 0
+	bytes := int64(0)
+
+	for i, entry := range entries {
+		info := entry.file.info
+		name := path.Join(prefix, entry.path)
+		modTime := time.Now()
+		if info.LocalTimeStamp > 0 {
+			modTime = time.Unix(0, info.LocalTimeStamp*int64(time.Millisecond))
+		}
+
+		if info.Directory {
+			err = archive.addDir(name, modTime)
+			if err != nil {
+				panic(err)
+			}
+			continue
+		}
+
+		m := manifestEntry{Path: entry.path, ComponentId: info.ScmInfo.ComponentId, ItemId: info.ScmInfo.ItemId, StateId: info.ScmInfo.StateId}
+
+		if info.Attributes.SymbolicLink {
+			err = archive.addLink(name, info.LinkTarget, modTime)
+			if err != nil {
+				panic(err)
+			}
+			m.LinkTarget = info.LinkTarget
+		} else {
+			contents := <-results[i]
+			<-ahead
+			if contents.err != nil {
+				panic(contents.err)
+			}
+
+			_, err = contents.temp.Seek(0, 0)
+			if err == nil {
+				err = archive.addFile(name, contents.size, modTime, contents.temp)
+			}
+			contents.temp.Close()
+			os.Remove(contents.temp.Name())
+			if err != nil {
+				panic(err)
+			}
+
+			m.Hash = contents.hash
+			bytes += contents.size
+			exported++
+			emit(Event{Type: EVENT_PROGRESS, Phase: "export", Files: exported, Total: numFiles, Bytes: bytes})
+		}
+
+		manifestEntries = append(manifestEntries, m)
+	}
+
+	return manifestEntries, bytes
+}
+
+// Download the contents of a file into a temporary file, taking them from the
+// shared cache when possible.
+func fetchExportContents(file File, tempDir string) exportedContents {
+	temp, err := ioutil.TempFile(tempDir, "contents")
+	if err != nil {
+		return exportedContents{err: err}
+	}
+
+	hash := sha1.New()
+	var size int64
+	scmInfo := file.info.ScmInfo
+
+	if cachedHash, objectPath, ok := cachedContents(scmInfo); ok {
+		var object *os.File
+		object, err = os.Open(objectPath)
+		if err == nil {
+			size, err = io.Copy(temp, object)
+			object.Close()
+		}
+		if err == nil {
+			return exportedContents{temp: temp, size: size, hash: cachedHash}
+		}
+
+		// Fall back to downloading the contents
+		temp.Truncate(0)
+		temp.Seek(0, 0)
+	}
+
+	downloadLimiter.acquire()
+	size, err = io.Copy(temp, io.TeeReader(&file, hash))
+	downloadLimiter.release(0, err)
+	file.Close()
+
+	if err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return exportedContents{err: err}
+	}
+
+	return exportedContents{temp: temp, size: size, hash: base64.StdEncoding.EncodeToString(hash.Sum(nil))}
+}
+
+func cachedContents(scmInfo ScmInfo) (string, string, bool) {
+	if objects == nil {
+		return "", "", false
+	}
+
+	return objects.lookup(scmInfo.ItemId, scmInfo.StateId)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestArchiveFormat(t *testing.T) {
+	for fileName, expected := range map[string]string{"release.zip": "zip", "release.tar": "tar", "release.TGZ": "tar.gz", "release.tar.gz": "tar.gz", "": "tar.gz", "-": "tar.gz"} {
+		format, err := archiveFormat("", fileName)
+		if err != nil || format != expected {
+			t.Errorf("%v should be a %v archive: %v %v", fileName, expected, format, err)
+		}
+	}
+
+	if format, _ := archiveFormat("zip", "release.tar"); format != "zip" {
+		t.Errorf("The format option should win over the file name: %v", format)
+	}
+	if _, err := archiveFormat("rar", ""); err == nil {
+		t.Errorf("Unknown formats should be rejected")
+	}
+	if _, err := archiveFormat("", "release.rar"); err == nil {
+		t.Errorf("Unknown file extensions should be rejected")
+	}
+}
+
+func exportFile(p string, contents string) remoteEntry {
+	file := File{reading: ioutil.NopCloser(strings.NewReader(contents))}
+	file.info.ScmInfo = ScmInfo{ComponentId: "comp", ItemId: "item-" + p, StateId: "state-" + p}
+	return remoteEntry{path: p, file: file}
+}
+
+func TestWriteExport(t *testing.T) {
+	captured, restore := captureEvents()
+	defer restore()
+
+	folder := remoteEntry{path: "src"}
+	folder.file.info.Directory = true
+	link := remoteEntry{path: "src/latest"}
+	link.file.info.Attributes.SymbolicLink = true
+	link.file.info.LinkTarget = "main.go"
+
+	entries := []remoteEntry{folder, exportFile("src/main.go", "package main\n"), link, exportFile("README.md", "Hello\n")}
+
+	out := &bytes.Buffer{}
+	archive := newArchiveWriter("tar", out)
+	manifestEntries, size := writeExport(archive, entries, "test-1.0")
+	err := archive.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if size != int64(len("package main\n")+len("Hello\n")) {
+		t.Errorf("Unexpected number of bytes exported: %v", size)
+	}
+	if len(manifestEntries) != 3 {
+		t.Fatalf("Folders should not be in the manifest: %v", manifestEntries)
+	}
+	hash := sha1.Sum([]byte("package main\n"))
+	if manifestEntries[0].Path != "src/main.go" || manifestEntries[0].Hash != base64.StdEncoding.EncodeToString(hash[:]) || manifestEntries[0].StateId != "state-src/main.go" {
+		t.Errorf("Unexpected manifest entry: %v", manifestEntries[0])
+	}
+	if manifestEntries[1].LinkTarget != "main.go" {
+		t.Errorf("The link target should be in the manifest: %v", manifestEntries[1])
+	}
+
+	expected := map[string]string{"test-1.0/src/": "", "test-1.0/src/main.go": "package main\n", "test-1.0/src/latest": "main.go", "test-1.0/README.md": "Hello\n"}
+	reader := tar.NewReader(out)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		contents, ok := expected[header.Name]
+		if !ok {
+			t.Errorf("Unexpected entry in the archive: %v", header.Name)
+			continue
+		}
+		delete(expected, header.Name)
+
+		if header.Typeflag == tar.TypeSymlink {
+			if header.Linkname != contents {
+				t.Errorf("Unexpected link target for %v: %v", header.Name, header.Linkname)
+			}
+			continue
+		}
+		b, _ := ioutil.ReadAll(reader)
+		if string(b) != contents {
+			t.Errorf("Unexpected contents for %v: %q", header.Name, string(b))
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("Entries missing from the archive: %v", expected)
+	}
+
+	progress := 0
+	for _, e := range captured.events {
+		if e.Type == EVENT_PROGRESS {
+			progress++
+		}
+	}
+	if progress != 2 {
+		t.Errorf("Expected progress for each file: %v", captured.events)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func acceptDefaults() {
+	fmt.Printf("gojazz accept [options]\n")
+	flag.PrintDefaults()
+}
+
+func deliverDefaults() {
+	fmt.Printf("gojazz deliver [options]\n")
+	flag.PrintDefaults()
+}
+
+// The sandbox, its local changes and the stream that its repository workspace
+// flows to, for accepting and delivering change sets
+func openFlow(sandboxPath string, operation string) (*status, *Client, soapworkspace) {
+	if sandboxPath == "" {
+		path, err := os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+		sandboxPath = findSandbox(path)
+	}
+
+	status, err := scmStatus(sandboxPath, NO_COPY)
+	if err != nil {
+		panic(err)
+	}
+
+	if status.metaData.isstream {
+		panic(simpleWarning("The sandbox is loaded from a stream, there is nothing to " + operation + ". Load again using a repository workspace."))
+	}
+	if status.metaData.readonly {
+		panic(simpleWarning("The sandbox is loaded from someone else's repository workspace, which you can't change. Load again using your own repository workspace."))
+	}
+
+	userId, password, err := getCredentials()
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := NewClient(userId, password)
+	if err != nil {
+		panic(err)
+	}
+
+	stream, err := FindFlowTarget(client, status.metaData.ccmBaseUrl, status.metaData.workspaceId)
+	if err != nil {
+		panic(err)
+	}
+	if stream.ItemId == "" {
+		panic(simpleWarning("Your repository workspace doesn't flow to a stream. Set its flow target on the website first."))
+	}
+	if stream.Name == "" {
+		stream.Name = stream.ItemId
+	}
+
+	return status, client, stream
+}
+
+// Report the change sets that are incoming from the stream and outgoing to it
+func emitFlowChanges(operation string, incoming []soapchangeset, outgoing []soapchangeset) {
+	for _, changeSet := range incoming {
+		emit(Event{Type: EVENT_CHANGE, Phase: operation, Path: changeSet.ItemId, Change: fmt.Sprintf("Incoming in %v: %v", changeSet.Component.Name, changeSetTitle(changeSet))})
+	}
+	for _, changeSet := range outgoing {
+		emit(Event{Type: EVENT_CHANGE, Phase: operation, Path: changeSet.ItemId, Change: fmt.Sprintf("Outgoing in %v: %v", changeSet.Component.Name, changeSetTitle(changeSet))})
+	}
+
+	emitMessage("%v incoming and %v outgoing change sets", len(incoming), len(outgoing))
+}
+
+// Fail when the server refused to accept or deliver because of conflicts or
+// gaps, nothing has changed in that case
+func checkFlow(operation string, conflicts []soapconflict, gaps []soapchangeset) {
+	for _, conflict := range conflicts {
+		emit(Event{Type: EVENT_CHANGE, Phase: operation, Path: conflict.Path, Change: "Conflict in " + conflict.Component.Name})
+	}
+	for _, gap := range gaps {
+		emit(Event{Type: EVENT_CHANGE, Phase: operation, Path: gap.ItemId, Change: fmt.Sprintf("Missing from %v: %v", gap.Component.Name, changeSetTitle(gap))})
+	}
+
+	if len(conflicts) > 0 {
+		panic(simpleWarning(fmt.Sprintf("Can't %v because of %v conflicting files. Nothing was changed, resolve the conflicts on the website.", operation, len(conflicts))))
+	}
+	if len(gaps) > 0 {
+		panic(simpleWarning(fmt.Sprintf("Can't %v because the change sets depend on %v change sets that are missing. Nothing was changed.", operation, len(gaps))))
+	}
+}
+
+func changeSetIds(changeSets []soapchangeset) []string {
+	ids := []string{}
+	for _, changeSet := range changeSets {
+		ids = append(ids, changeSet.ItemId)
+	}
+
+	return ids
+}
+
+// Accept the incoming change sets from the stream into the repository
+// workspace and load them into the sandbox
+func acceptOp() {
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	force := flag.Bool("force", false, "Don't prompt for anything. Clobber files when necessary.")
+	transfer := transferFlags()
+	flag.Usage = acceptDefaults
+	flag.Parse()
+	transfer.apply()
+
+	status, client, stream := openFlow(*sandboxPath, "accept")
+	metadata := status.metaData
+
+	// Loading the accepted changes would overwrite local changes
+	if !status.unchanged() {
+		panic(simpleWarning(fmt.Sprintf("The sandbox has %v local changes. Check them in with checkin or sync before you accept.", len(status.entries()))))
+	}
+	if len(metadata.conflicts) > 0 {
+		panic(simpleWarning("The sandbox has unresolved conflicts. Resolve them and sync before you accept."))
+	}
+
+	incoming, err := FindIncomingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId)
+	if err != nil {
+		panic(err)
+	}
+	outgoing, err := FindOutgoingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId)
+	if err != nil {
+		panic(err)
+	}
+	emitFlowChanges("accept", incoming, outgoing)
+
+	if len(incoming) == 0 {
+		emitMessage("Your repository workspace is up to date with %v", stream.Name)
+		return
+	}
+
+	conflicts, gaps, err := AcceptChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId, changeSetIds(incoming))
+	if err != nil {
+		panic(err)
+	}
+	checkFlow("accept", conflicts, gaps)
+
+	scmLoad(client, metadata.ccmBaseUrl, metadata.projectName, metadata.workspaceId, metadata.isstream, metadata.readonly, metadata.userId, status.sandboxPath, status, *force, nil, nil)
+
+	emit(Event{Type: EVENT_SUMMARY, Phase: "accept", Path: status.sandboxPath, Files: len(incoming), Message: fmt.Sprintf("Accepted %v change sets from %v", len(incoming), stream.Name)})
+}
+
+// Deliver the outgoing change sets of the repository workspace to the stream
+func deliverOp() {
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	flag.Usage = deliverDefaults
+	flag.Parse()
+
+	status, client, stream := openFlow(*sandboxPath, "deliver")
+	metadata := status.metaData
+
+	if !status.unchanged() {
+		emitWarning("%v local changes are not checked in and won't be delivered", len(status.entries()))
+	}
+
+	incoming, err := FindIncomingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId)
+	if err != nil {
+		panic(err)
+	}
+	outgoing, err := FindOutgoingChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId)
+	if err != nil {
+		panic(err)
+	}
+	emitFlowChanges("deliver", incoming, outgoing)
+
+	if len(outgoing) == 0 {
+		emitMessage("There is nothing to deliver to %v", stream.Name)
+		return
+	}
+
+	conflicts, gaps, err := DeliverChangeSets(client, metadata.ccmBaseUrl, metadata.workspaceId, stream.ItemId, changeSetIds(outgoing))
+	if err != nil {
+		panic(err)
+	}
+	checkFlow("deliver", conflicts, gaps)
+
+	emit(Event{Type: EVENT_SUMMARY, Phase: "deliver", Path: status.sandboxPath, Files: len(outgoing), Message: fmt.Sprintf("Delivered %v change sets to %v", len(outgoing), stream.Name)})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckFlow(t *testing.T) {
+	captured, restore := captureEvents()
+	defer restore()
+
+	failed := func(conflicts []soapconflict, gaps []soapchangeset) (failed bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				failed = true
+			}
+		}()
+		checkFlow("accept", conflicts, gaps)
+		return false
+	}
+
+	if failed(nil, nil) {
+		t.Errorf("Accepting without conflicts or gaps should succeed")
+	}
+	if len(captured.events) != 0 {
+		t.Errorf("Nothing should be reported without conflicts or gaps: %v", captured.events)
+	}
+
+	conflict := soapconflict{Path: "src/main.go", Component: soapcomponent{Name: "Web UI"}}
+	if !failed([]soapconflict{conflict}, nil) {
+		t.Errorf("Accepting with conflicts should fail")
+	}
+	if len(captured.events) != 1 || captured.events[0].Type != EVENT_CHANGE || captured.events[0].Path != "src/main.go" || captured.events[0].Change != "Conflict in Web UI" {
+		t.Errorf("The conflict should be reported: %v", captured.events)
+	}
+
+	captured.events = nil
+	gap := soapchangeset{ItemId: "_cs1", Comment: "Fix the login page", Component: soapcomponent{Name: "Web UI"}}
+	if !failed(nil, []soapchangeset{gap}) {
+		t.Errorf("Accepting with gaps should fail")
+	}
+	if len(captured.events) != 1 || captured.events[0].Path != "_cs1" || captured.events[0].Change != "Missing from Web UI: Fix the login page" {
+		t.Errorf("The missing change set should be reported: %v", captured.events)
+	}
+}
+
+func TestEmitFlowChanges(t *testing.T) {
+	captured, restore := captureEvents()
+	defer restore()
+
+	incoming := []soapchangeset{{ItemId: "_in", Comment: "Their fix", Component: soapcomponent{Name: "Server"}}}
+	outgoing := []soapchangeset{{ItemId: "_out1", Component: soapcomponent{Name: "Web UI"}}, {ItemId: "_out2", Comment: "My feature\nwith details", Component: soapcomponent{Name: "Web UI"}}}
+	emitFlowChanges("deliver", incoming, outgoing)
+
+	changes := []string{}
+	for _, e := range captured.events {
+		if e.Type == EVENT_CHANGE && e.Phase == "deliver" {
+			changes = append(changes, e.Path+" "+e.Change)
+		}
+	}
+	expected := []string{"_in Incoming in Server: Their fix", "_out1 Outgoing in Web UI: <No comment>", "_out2 Outgoing in Web UI: My feature"}
+	if len(changes) != len(expected) {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	for i, _ := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], changes[i])
+		}
+	}
+
+	last := captured.events[len(captured.events)-1]
+	if last.Type != EVENT_MESSAGE || last.Message != "1 incoming and 2 outgoing change sets" {
+		t.Errorf("Unexpected summary: %v", last)
+	}
+}
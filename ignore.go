@@ -0,0 +1,308 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	ignoreFileName   = ".jazzignore"
+	globalIgnoreFile = "ignore"
+
+	// Files bigger than this are most likely not source code
+	maxUnignoredSize = 10 * 1024 * 1024
+)
+
+// Things that are usually not source code. Any .jazzignore file can bring them
+// back with a negated pattern (e.g. !bin/).
+var defaultIgnores = []string{
+	"bin/",
+	"*.exe",
+	"*.dll",
+	"*.so",
+	"*~",
+	"*.swp",
+}
+
+// A pattern from an ignore file with the semantics of gitignore
+type ignorePattern struct {
+	base     string // Folder of the ignore file relative to the sandbox, empty for the root
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+// Decides which files and folders of a sandbox are ignored. Later patterns win
+// over earlier ones. The defaults come first, then the user's global ignore
+// file (~/.gojazz/ignore) and then the .jazzignore files from the root of the
+// sandbox down to the folder of the path.
+type ignorer struct {
+	sandbox string
+	global  []ignorePattern
+
+	mutex   sync.Mutex
+	files   map[string][]ignorePattern
+	folders map[string]bool
+}
+
+func newIgnorer(sandbox string) *ignorer {
+	ig := &ignorer{sandbox: sandbox, files: make(map[string][]ignorePattern), folders: make(map[string]bool)}
+
+	ig.global = parseIgnorePatterns(strings.Join(defaultIgnores, "\n"), "")
+
+	usr, err := user.Current()
+	if err == nil {
+		b, err := ioutil.ReadFile(filepath.Join(usr.HomeDir, gojazzDataDir, globalIgnoreFile))
+		if err == nil {
+			ig.global = append(ig.global, parseIgnorePatterns(string(b), "")...)
+		}
+	}
+
+	return ig
+}
+
+// Check whether changes to the file or folder at the path are ignored
+func IsIgnored(path string) (bool, error) {
+	return newIgnorer(findSandbox(filepath.Dir(path))).ignored(path)
+}
+
+// Check whether the file or folder at the path, or any of its parent folders, is
+// ignored. Paths that no longer exist are treated as files.
+func (ig *ignorer) ignored(p string) (bool, error) {
+	rel, err := filepath.Rel(ig.sandbox, p)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	if rel == "." {
+		return false, nil
+	}
+
+	// The metadata, staging, backup and pristine areas are never part of the sandbox contents
+	first := strings.SplitN(rel, "/", 2)[0]
+	if first == metadataFileName || first == stageFolder || first == backupFolder || first == pristineFolder {
+		return true, nil
+	}
+
+	isDir := false
+	size := int64(0)
+	info, err := os.Lstat(p)
+	if err == nil {
+		isDir = info.IsDir()
+		size = info.Size()
+	}
+
+	ig.mutex.Lock()
+	defer ig.mutex.Unlock()
+
+	parent := path.Dir(rel)
+	if parent != "." && ig.folderIgnored(parent) {
+		return true, nil
+	}
+
+	return ig.entryIgnored(rel, isDir, size), nil
+}
+
+func (ig *ignorer) folderIgnored(rel string) bool {
+	result, ok := ig.folders[rel]
+	if ok {
+		return result
+	}
+
+	parent := path.Dir(rel)
+	result = (parent != "." && ig.folderIgnored(parent)) || ig.entryIgnored(rel, true, 0)
+	ig.folders[rel] = result
+
+	return result
+}
+
+// Apply the patterns to the path without looking at its parent folders
+func (ig *ignorer) entryIgnored(rel string, isDir bool, size int64) bool {
+	matched := false
+	ignored := false
+
+	apply := func(patterns []ignorePattern) {
+		for _, pattern := range patterns {
+			if pattern.matches(rel, isDir) {
+				matched = true
+				ignored = !pattern.negate
+			}
+		}
+	}
+
+	apply(ig.global)
+	apply(ig.patternsIn(""))
+
+	segments := strings.Split(rel, "/")
+	for i := 1; i < len(segments); i++ {
+		apply(ig.patternsIn(strings.Join(segments[:i], "/")))
+	}
+
+	// Big files are ignored unless a pattern explicitly includes them
+	if !matched && !isDir && size > maxUnignoredSize {
+		return true
+	}
+
+	return ignored
+}
+
+// The patterns of the ignore file in the folder, if there is one
+func (ig *ignorer) patternsIn(folder string) []ignorePattern {
+	patterns, ok := ig.files[folder]
+	if ok {
+		return patterns
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(ig.sandbox, filepath.FromSlash(folder), ignoreFileName))
+	if err == nil {
+		patterns = parseIgnorePatterns(string(b), folder)
+	}
+	ig.files[folder] = patterns
+
+	return patterns
+}
+
+func (pattern ignorePattern) matches(rel string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+
+	sub := rel
+	if pattern.base != "" {
+		if !strings.HasPrefix(rel, pattern.base+"/") {
+			return false
+		}
+		sub = rel[len(pattern.base)+1:]
+	}
+
+	// Patterns without a slash match the name at any depth
+	if !pattern.anchored {
+		sub = path.Base(sub)
+	}
+
+	return pattern.re.MatchString(sub)
+}
+
+// Parse the lines of an ignore file. Invalid patterns are skipped like git does.
+func parseIgnorePatterns(contents string, base string) []ignorePattern {
+	patterns := []ignorePattern{}
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		// Trailing spaces are ignored unless they are escaped
+		trimmed := strings.TrimRight(line, " \t")
+		if strings.HasSuffix(trimmed, "\\") && len(trimmed) < len(line) {
+			trimmed = trimmed[:len(trimmed)-1] + " "
+		}
+		line = trimmed
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := ignorePattern{base: base}
+
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			pattern.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		re, err := globToRegexp(line)
+		if err != nil {
+			continue
+		}
+		pattern.re = re
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+// Translate a glob with gitignore's ** into a regular expression
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	segments := strings.Split(glob, "/")
+	expr := "^"
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		if segment == "**" {
+			if last {
+				expr += ".*"
+			} else {
+				expr += "(?:.*/)?"
+			}
+			continue
+		}
+
+		expr += globSegmentToRegexp(segment)
+		if !last {
+			expr += "/"
+		}
+	}
+
+	return regexp.Compile(expr + "$")
+}
+
+func globSegmentToRegexp(segment string) string {
+	expr := ""
+
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+
+		switch c {
+		case '*':
+			expr += "[^/]*"
+		case '?':
+			expr += "[^/]"
+		case '\\':
+			if i+1 < len(segment) {
+				i++
+				expr += regexp.QuoteMeta(string(segment[i]))
+			}
+		case '[':
+			end := strings.Index(segment[i+1:], "]")
+			if end == -1 {
+				expr += regexp.QuoteMeta("[")
+				continue
+			}
+
+			class := segment[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + strings.Replace(class, "\\", "\\\\", -1) + "]"
+			i += end + 1
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+
+	return expr
+}
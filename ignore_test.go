@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	sandbox, err := ioutil.TempDir(os.TempDir(), "gojazz-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	files := map[string]string{
+		ignoreFileName:                  "build/\nnode_modules/\n/TODO\n*.log\n!keep.log\ndocs/**/*.pdf\n",
+		"scripts/" + ignoreFileName:     "!bin/\n",
+		"scripts/bin/run.sh":            "",
+		"bin/tool":                      "",
+		"build/out.o":                   "",
+		"src/build/Main.java":           "",
+		"src/build.txt":                 "",
+		"web/node_modules/lib/index.js": "",
+		"TODO":                          "",
+		"src/TODO":                      "",
+		"a.log":                         "",
+		"src/keep.log":                  "",
+		"docs/guide.pdf":                "",
+		"docs/x/y/guide.pdf":            "",
+		"app.exe":                       "",
+	}
+	for p, contents := range files {
+		p = filepath.Join(sandbox, filepath.FromSlash(p))
+		err = os.MkdirAll(filepath.Dir(p), 0700)
+		if err != nil {
+			panic(err)
+		}
+		err = ioutil.WriteFile(p, []byte(contents), 0600)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	expected := map[string]bool{
+		"scripts/bin/run.sh":            false,
+		"bin/tool":                      true,
+		"build/out.o":                   true,
+		"src/build/Main.java":           true,
+		"src/build.txt":                 false,
+		"web/node_modules/lib/index.js": true,
+		"TODO":                          true,
+		"src/TODO":                      false,
+		"a.log":                         true,
+		"src/keep.log":                  false,
+		"docs/guide.pdf":                true,
+		"docs/x/y/guide.pdf":            true,
+		"app.exe":                       true,
+		ignoreFileName:                  false,
+		metadataFileName:                true,
+	}
+
+	ignores := newIgnorer(sandbox)
+	for p, result := range expected {
+		ignored, err := ignores.ignored(filepath.Join(sandbox, filepath.FromSlash(p)))
+		if err != nil {
+			panic(err)
+		}
+		if ignored != result {
+			t.Errorf("Expected ignored to be %v for %v", result, p)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Whether a component of the sandbox changed in the repository since the load
+type componentStatus struct {
+	Name        string `json:"name"`
+	ComponentId string `json:"componentId"`
+	Changed     bool   `json:"changed"`
+}
+
+// Find the components that changed in the repository workspace or stream
+// by their ETags and walk them to find the incoming changes to their files.
+// Incoming changes to files that also changed locally are conflicts.
+func (status *status) remoteChanges(client *Client) ([]componentStatus, []statusEntry) {
+	metadata := status.metaData
+
+	components, err := FindComponents(client, metadata.ccmBaseUrl, metadata.workspaceId)
+	if err != nil {
+		panic(err)
+	}
+
+	componentStatuses := []componentStatus{}
+	incoming := []statusEntry{}
+
+	for _, component := range components {
+		componentId := component.ScmInfo.ItemId
+
+		root, err := Open(client, metadata.ccmBaseUrl, metadata.workspaceId, componentId, "")
+		if err != nil {
+			panic(err)
+		}
+
+		changed := root.etag != metadata.componentEtag[componentId]
+		componentStatuses = append(componentStatuses, componentStatus{Name: component.Name, ComponentId: componentId, Changed: changed})
+		if !changed {
+			continue
+		}
+
+		// The walk records the ETags in its own metadata, the sandbox hasn't
+		//  caught up with them
+		remote := []remoteEntry{}
+		mutex := &sync.Mutex{}
+		err = Walk(client, metadata.ccmBaseUrl, metadata.workspaceId, componentId, newMetaData(), func(p string, file File) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			remote = append(remote, remoteEntry{path: p, file: file})
+			return nil
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		for _, change := range compareConfigurations(status.loadedEntries(componentId), remote) {
+			entry := statusEntry{Path: change.path, From: change.from, ComponentId: componentId}
+			switch change.change {
+			case "Removed":
+				entry.Change = "Deleted"
+				entry.ItemId = change.source.file.info.ScmInfo.ItemId
+			case "Changed":
+				entry.Change = "Modified"
+				entry.ItemId = change.target.file.info.ScmInfo.ItemId
+			default:
+				entry.Change = change.change
+				entry.ItemId = change.target.file.info.ScmInfo.ItemId
+			}
+
+			entry.Conflict = status.changedLocally(entry.Path) || (entry.From != "" && status.changedLocally(entry.From))
+			incoming = append(incoming, entry)
+		}
+	}
+
+	sort.Sort(byEntryPath(incoming))
+
+	return componentStatuses, incoming
+}
+
+// The items of the component as they were loaded into the sandbox
+func (status *status) loadedEntries(componentId string) []remoteEntry {
+	entries := []remoteEntry{}
+
+	for p, meta := range status.metaData.pathMap {
+		if meta.ComponentId != componentId {
+			continue
+		}
+
+		info := FileInfo{Name: filepath.Base(p), LinkTarget: meta.LinkTarget, ScmInfo: ScmInfo{ComponentId: meta.ComponentId, ItemId: meta.ItemId, StateId: meta.StateId}}
+		info.Directory = meta.Hash == "" && meta.LinkTarget == ""
+		info.Attributes.SymbolicLink = meta.LinkTarget != ""
+
+		entries = append(entries, remoteEntry{path: filepath.ToSlash(p), file: File{info: info}})
+	}
+
+	return entries
+}
+
+// Check whether the item at the path, or one of its parent folders, has a local change
+func (status *status) changedLocally(p string) bool {
+	rel := filepath.FromSlash(p)
+
+	for dir := rel; dir != "."; dir = filepath.Dir(dir) {
+		if status.Added[dir] || status.Modified[dir] || status.Deleted[dir] {
+			return true
+		}
+		if _, ok := status.Moved[dir]; ok {
+			return true
+		}
+	}
+
+	return status.movedAway(rel)
+}
+
+func emitIncoming(components []componentStatus, incoming []statusEntry) {
+	for _, component := range components {
+		if component.Changed {
+			emitMessage("Component %v has incoming changes", component.Name)
+		} else {
+			emitMessage("Component %v is up to date", component.Name)
+		}
+	}
+
+	conflicts := 0
+	for _, entry := range incoming {
+		change := "Incoming " + entry.Change
+		if entry.Conflict {
+			change = change + ", Conflict"
+			conflicts++
+		}
+		emit(Event{Type: EVENT_CHANGE, Phase: "remote", Path: entry.Path, From: entry.From, Change: change})
+	}
+
+	summary := Event{Type: EVENT_SUMMARY, Phase: "remote", Files: len(incoming), Message: fmt.Sprintf("%v incoming changes, %v potential conflicts", len(incoming), conflicts)}
+	if len(incoming) == 0 {
+		summary.Message = "No incoming changes"
+	}
+	emit(summary)
+}
+
+// A client for the repository of the sandbox. Streams of public projects can be
+// read without credentials.
+func sandboxClient(metadata *metaData) *Client {
+	userId := ""
+	password := ""
+	if !metadata.isstream || isLoggedIn() {
+		var err error
+		userId, password, err = getCredentials()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	client, err := NewClient(userId, password)
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
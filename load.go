@@ -10,12 +10,12 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
+	"reflect"
 	"strings"
-	"time"
 )
 
 const (
+	// Initial number of concurrent downloads
 	numGoRoutines = 10
 	bufferSize    = 1000
 )
@@ -32,6 +32,12 @@ func loadOp() {
 	stream := &streamDef
 	workspaceDef := false
 	workspace := &workspaceDef
+	workspaceNameDef := ""
+	workspaceName := &workspaceNameDef
+	workspaceItemIdDef := ""
+	workspaceItemId := &workspaceItemIdDef
+	listDef := false
+	list := &listDef
 
 	// Project name provided
 	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
@@ -41,12 +47,60 @@ func loadOp() {
 		// Providing a workspace or stream is only valid in the context of a project
 		stream = flag.String("stream", "", "Alternate stream to load")
 		workspace = flag.Bool("workspace", false, "Use a repository workspace to check-in changes (requires authentication).")
+		workspaceName = flag.String("workspace-name", "", "Load the repository workspace with this name. Workspaces owned by someone else are loaded read-only.")
+		workspaceItemId = flag.String("workspace-id", "", "Load the repository workspace with this item ID. Workspaces owned by someone else are loaded read-only.")
+		list = flag.Bool("list-workspaces", false, "List the repository workspaces of the project and exit.")
 	}
 
 	sandboxPath := flag.String("sandbox", "", "Location of the sandbox to load the files")
 	force := flag.Bool("force", false, "Force the load to overwrite any files. Don't prompt.")
+	eol := flag.String("eol", "", "Line delimiter conversion for the sandbox (e.g. 'auto,*.sh=lf,*.bat=crlf'). Styles are lf, crlf, auto and none.")
+	pristineFlag := flag.Bool("pristine", false, "Keep compressed copies of the loaded files in the sandbox so that diff and revert work offline. The setting is remembered for the sandbox.")
+	transfer := transferFlags()
 	flag.Usage = loadDefaults
 	flag.Parse()
+	transfer.apply()
+
+	// Keep the existing pristine store setting of the sandbox unless it is provided
+	var pristine *bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "pristine" {
+			pristine = pristineFlag
+		}
+	})
+
+	// Keep the existing line delimiter settings of the sandbox unless new ones are provided
+	var eolRules []eolRule
+	if *eol != "" {
+		var err error
+		eolRules, err = parseEolRules(*eol)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if *list {
+		userId, password, err := getCredentials()
+		if err != nil {
+			panic(err)
+		}
+		client, err := NewClient(userId, password)
+		if err != nil {
+			panic(err)
+		}
+		project, err := client.findProject(projectName)
+		if err != nil {
+			panic(err)
+		}
+
+		listWorkspaces(client, project.CcmBaseUrl, projectName)
+		return
+	}
+
+	// A named repository workspace is still a repository workspace
+	if *workspaceName != "" || *workspaceItemId != "" {
+		*workspace = true
+	}
 
 	if *sandboxPath == "" {
 		path, err := os.Getwd()
@@ -63,8 +117,19 @@ func loadOp() {
 	status, _ := scmStatus(*sandboxPath, BACKUP)
 
 	if status != nil && !status.unchanged() {
-		fmt.Printf("Here was the status of your sandbox before loading:\n%v", status)
-		fmt.Printf("Your changes have been backed up to this location: %v\n", status.copyPath)
+		emitMessage("Here was the status of your sandbox before loading:\n%v", status)
+
+		backup, err := status.saveBackup("load")
+		if err != nil {
+			panic(err)
+		}
+		emitWarning("Your changes have been backed up to this location: %v", backup.dir)
+		emitMessage("Use 'gojazz backup restore %v' to bring them back", backup.Id)
+
+		_, err = pruneBackups(*sandboxPath, defaultBackupKeep, defaultBackupDays)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	// You don't need credentials to load streams of public projects
@@ -88,16 +153,17 @@ func loadOp() {
 		panic(err)
 	}
 
-	fmt.Printf("Loading into %v...\n", *sandboxPath)
+	emitMessage("Loading into %v...", *sandboxPath)
 
 	var isstream bool
+	readonly := false
 	workspaceId := ""
 	ccmBaseUrl := ""
 
 	// This is either a fresh sandbox or project/stream/workspace information was provided
 	if status == nil || projectName != "" {
 		if projectName == "" {
-			fmt.Println("Provide a project to load and try again.")
+			emitWarning("Provide a project to load and try again.")
 			loadDefaults()
 			return
 		}
@@ -110,22 +176,26 @@ func loadOp() {
 
 		// Find a repository workspace with the correct naming convention
 		// Failing that, create one.
-		if *workspace {
+		if *workspaceItemId != "" {
+			isstream = false
+			workspaceId, readonly = findWorkspaceById(client, ccmBaseUrl, *workspaceItemId)
+		} else if *workspaceName != "" {
+			isstream = false
+			workspaceId, readonly = findNamedWorkspace(client, ccmBaseUrl, projectName, *workspaceName)
+		} else if *workspace {
 			isstream = false
 
 			streamId := ""
 
 			// User has provided a stream that they want to work on
 			if *stream != "" {
-				// TODO someday we will support the ability to work on different streams
-				//	streamId, err = FindStream(client, ccmBaseUrl, projectName, *stream)
-				//	if err != nil {
-				//		panic(err)
-				//	}
-				//	if streamId == "" {
-				//		panic(errors.New("Stream with name " + *stream + " not found"))
-				//	}
-				panic(simpleWarning("Sorry, we don't yet support loading repository workspaces from a specific stream. You can only use the default for now."))
+				streamId, err = FindStream(client, ccmBaseUrl, projectName, *stream)
+				if err != nil {
+					panic(err)
+				}
+				if streamId == "" {
+					panic(simpleWarning("Stream with name " + *stream + " not found"))
+				}
 			} else {
 				// Otherwise, use a stream that matches the naming convention
 				streamId, err = FindStream(client, ccmBaseUrl, projectName, projectName+" Stream")
@@ -138,17 +208,32 @@ func loadOp() {
 				}
 			}
 
+			// Reuse the user's repository workspace that flows to the stream
 			workspaceId, err = FindWorkspaceForStream(client, ccmBaseUrl, streamId)
 			if err != nil {
 				panic(err)
 			}
-			if workspaceId == "" {
-				// TODO someday we will be able to create a repository workspace from a stream, for now we use the init project rest call and hope that the workspace is for the stream the user specified
-				//	workspaceId, err = CreateWorkspaceFromStream(client, ccmBaseUrl, projectName, *userId, streamId, projectName+" Stream")
-				//	if err != nil {
-				//		panic(err)
-				//	}
+			if workspaceId == "" && *stream != "" {
+				emitMessage("Creating a repository workspace for stream %v...", *stream)
+
+				// The repository workspace is created inside the user's web IDE project
+				webIdeProject, err := findWebIdeProject(client, project)
+				if err != nil {
+					panic(err)
+				}
+				if webIdeProject == "" {
+					_, err = initWebIdeProject(client, project, userId)
+					if err != nil {
+						panic(err)
+					}
+				}
 
+				workspaceId, err = CreateWorkspaceFromStream(client, ccmBaseUrl, projectName, streamId, *stream, *stream+" Workspace")
+				if err != nil {
+					panic(err)
+				}
+			} else if workspaceId == "" {
+				// The web IDE project initialization creates the repository workspace for the default stream
 				workspaceId, err = initWebIdeProject(client, project, userId)
 
 				if err != nil {
@@ -183,21 +268,25 @@ func loadOp() {
 	} else {
 		projectName = status.metaData.projectName
 		isstream = status.metaData.isstream
+		readonly = status.metaData.readonly
 		workspaceId = status.metaData.workspaceId
 		ccmBaseUrl = status.metaData.ccmBaseUrl
 	}
 
 	if isstream {
-		fmt.Printf("Note: Loading from a stream will not allow you to contribute changes. You must load again using the '-workspace=true' option.\n")
+		emitWarning("Note: Loading from a stream will not allow you to contribute changes. You must load again using the '-workspace=true' option.")
+	}
+	if readonly {
+		emitWarning("Note: This repository workspace belongs to someone else. The sandbox is read-only and will not allow you to contribute changes.")
 	}
 
-	scmLoad(client, ccmBaseUrl, projectName, workspaceId, isstream, userId, *sandboxPath, status, *force)
+	scmLoad(client, ccmBaseUrl, projectName, workspaceId, isstream, readonly, userId, *sandboxPath, status, *force, eolRules, pristine)
 
-	fmt.Printf("Load Successful\n")
+	emit(Event{Type: EVENT_SUMMARY, Phase: "load", Path: *sandboxPath, Message: "Load Successful"})
 
 	// If we loaded from a repository workspace then init the web IDE project and
 	//  provide a URL for them to manage their changes
-	if !isstream {
+	if !isstream && !readonly {
 		project, err := client.findProject(projectName)
 		if err != nil {
 			panic(err)
@@ -216,21 +305,50 @@ func loadOp() {
 			}
 		}
 
-		fmt.Println("Visit the following link to work with your repository workspace:")
 		redirect := fmt.Sprintf(jazzHubBaseUrl + "/code/jazzui/changes.html#" + "/code/jazz/Changes/_/file/" + client.GetJazzId() + "-OrionContent/" + projectName)
-		fmt.Printf("https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=%v\n", url.QueryEscape(redirect))
+		emit(Event{Type: EVENT_MESSAGE, Message: "Visit the following link to work with your repository workspace:", Url: "https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=" + url.QueryEscape(redirect)})
 	}
 }
 
-func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId string, stream bool, userId string, sandbox string, status *status, force bool) {
+// Load the remote workspace or stream into the sandbox. The eolRules replace the
+// line delimiter settings of the sandbox and pristine turns the pristine store
+// on or off, nil keeps the existing settings.
+func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId string, stream bool, readonly bool, userId string, sandbox string, status *status, force bool, eolRules []eolRule, pristine *bool) {
 	newMetaData := newMetaData()
 	newMetaData.initConcurrentWrite()
 	newMetaData.isstream = stream
+	newMetaData.readonly = readonly
 	newMetaData.userId = userId
 	newMetaData.ccmBaseUrl = ccmBaseUrl
 	newMetaData.projectName = projectName
 	newMetaData.workspaceId = workspaceId
 
+	if eolRules != nil {
+		newMetaData.eolRules = eolRules
+
+		// Files need to be converted again if the line delimiter settings changed
+		if status != nil && !reflect.DeepEqual(status.metaData.eolRules, eolRules) {
+			status.metaData.pathMap = make(map[string]metaObject)
+		}
+	} else if status != nil {
+		newMetaData.eolRules = status.metaData.eolRules
+	}
+	if status != nil {
+		newMetaData.componentRules = status.metaData.componentRules
+	}
+
+	if pristine != nil {
+		newMetaData.pristine = *pristine
+	} else if status != nil {
+		newMetaData.pristine = status.metaData.pristine
+	}
+	if !newMetaData.pristine {
+		err := os.RemoveAll(filepath.Join(sandbox, pristineFolder))
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	if status != nil {
 		// Delete any files that were added/modified (they should already be backed up)
 		for addedPath, _ := range status.Added {
@@ -245,6 +363,12 @@ func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId
 				panic(err)
 			}
 		}
+		for movedPath, _ := range status.Moved {
+			err := os.RemoveAll(filepath.Join(sandbox, movedPath))
+			if err != nil {
+				panic(err)
+			}
+		}
 	} else {
 		// Check if there are any files in the sandbox, fail if there are any
 		stat, _ := os.Stat(sandbox)
@@ -260,6 +384,10 @@ func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId
 				panic(err)
 			}
 
+			if len(children) > 0 && !force && jsonOutput() {
+				panic(simpleWarning("There are files in the sandbox directory that would be replaced with the remote files. Use the -force option to replace them."))
+			}
+
 			if len(children) > 0 && !force {
 				fmt.Println("There are files in the sandbox directory that will be replaced with the remote files.")
 				fmt.Print("Do you want to proceed? [Y/n]:")
@@ -285,9 +413,15 @@ func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId
 	}
 
 	// Walk through the remote components creating directories, if necessary and cleaning up any deleted files
+	emit(Event{Type: EVENT_PHASE_STARTED, Phase: "load", Path: sandbox})
+	totals := loadTotals{}
+	ignores := newIgnorer(sandbox)
 	for _, component := range components {
-		loadComponent(client, ccmBaseUrl, workspaceId, component.ScmInfo.ItemId, sandbox, newMetaData, status)
+		componentTotals := loadComponent(client, ccmBaseUrl, workspaceId, component.ScmInfo.ItemId, sandbox, newMetaData, status, ignores)
+		totals.files += componentTotals.files
+		totals.bytes += componentTotals.bytes
 	}
+	emit(Event{Type: EVENT_PHASE_FINISHED, Phase: "load", Path: sandbox, Files: totals.files, Bytes: totals.bytes})
 
 	// Do a final pass over the top-level elements in the sandbox
 	//  to remove any that are no longer registered in the metadata.
@@ -302,7 +436,7 @@ func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId
 	for _, root := range roots {
 		rootPath := filepath.Join(sandbox, root)
 
-		ignored, err := IsIgnored(rootPath)
+		ignored, err := ignores.ignored(rootPath)
 		if err != nil {
 			panic(err)
 		}
@@ -321,16 +455,75 @@ func scmLoad(client *Client, ccmBaseUrl string, projectName string, workspaceId
 		}
 	}
 
+	// Merge conflicts stay until they are resolved, unless the files were loaded again
+	if status != nil {
+		for p, _ := range status.metaData.conflicts {
+			if !status.Modified[p] && !status.Deleted[p] {
+				newMetaData.conflicts[p] = true
+			}
+		}
+	}
+
 	newMetaData.save(metadataFile)
+
+	if store := newMetaData.pristineStore(sandbox); store != nil {
+		err = store.prune(newMetaData)
+		if err != nil {
+			emitWarning("Unable to prune the pristine copies: %v", err)
+		}
+	}
+
+	// Keep the shared cache within its size
+	if objects != nil {
+		_, _, err = objects.prune(objects.maxSize)
+		if err != nil {
+			emitWarning("Unable to prune the cache: %v", err)
+		}
+	}
 }
 
-func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, componentId string, sandbox string, newMetaData *metaData, status *status) {
+// The pristine copies are only a convenience, the load carries on without them
+func keepPristine(store *pristineStore, localPath string, eol eolStyle, hash string) {
+	err := store.put(localPath, eol, hash)
+	if err != nil {
+		emitWarning("Unable to keep a pristine copy of %v: %v", localPath, err)
+	}
+}
+
+// Number of files and bytes that were loaded
+type loadTotals struct {
+	files int
+	bytes int64
+}
+
+// Metadata of a file whose contents were just written to the sandbox
+func downloadedMeta(localPath string, scmInfo ScmInfo, hash string) metaObject {
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		panic(err)
+	}
+
+	meta := metaObject{
+		Path:        localPath,
+		ItemId:      scmInfo.ItemId,
+		StateId:     scmInfo.StateId,
+		ComponentId: scmInfo.ComponentId,
+		Hash:        hash,
+	}
+	meta.recordStat(stat)
+
+	return meta
+}
+
+func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, componentId string, sandbox string, newMetaData *metaData, status *status, ignores *ignorer) loadTotals {
 	// Optimization: if status is unchanged and the component's ETag is the same
 	//  then we can skip downloading this component
 	if status != nil && status.unchanged() {
 		// TODO implement the optimization
 	}
 
+	pristine := newMetaData.pristineStore(sandbox)
+
 	// Queue of paths to download (empty string means we are done)
 	downloadQueue := make(chan string, bufferSize)
 	// Queue of finished messages from the go routines
@@ -338,13 +531,13 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 
 	// Load status updates
 	trackerFinish := make(chan bool)
+	trackerTotals := make(chan loadTotals)
 	workTracker := make(chan bool)
 	workTransfer := make(chan int64)
 	go func() {
 		work := 0
 		worked := 0
 		transferred := int64(0)
-		lastStringLength := 0
 
 		for {
 			select {
@@ -357,29 +550,9 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 					worked += 1
 				}
 
-				// Backspace and space out the last line that was printed
-				for i := 0; i < lastStringLength; i++ {
-					fmt.Printf("\b")
-				}
-				for i := 0; i < lastStringLength; i++ {
-					fmt.Printf(" ")
-				}
-				for i := 0; i < lastStringLength; i++ {
-					fmt.Printf("\b")
-				}
-
-				bytesLoaded := ""
-				// TODO handle Gigabytes?
-				if transferred > (1024 * 1024) {
-					bytesLoaded = strconv.FormatInt(transferred/(1024*1024), 10) + "MB"
-				} else if transferred > 1024 {
-					bytesLoaded = strconv.FormatInt(transferred/1024, 10) + "KB"
-				} else {
-					bytesLoaded = strconv.FormatInt(transferred, 10) + "B"
-				}
-
-				lastStringLength, _ = fmt.Printf("Loaded %v (of %v) files. %v", worked, work, bytesLoaded)
+				emit(Event{Type: EVENT_PROGRESS, Phase: "load", Files: worked, Total: work, Bytes: transferred})
 			case <-trackerFinish:
+				trackerTotals <- loadTotals{files: worked, bytes: transferred}
 				return
 			}
 		}
@@ -398,14 +571,9 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 
 				workTracker <- true
 
-				remoteFile, err := Open(client, ccmBaseUrl, workspaceId, componentId, pathToDownload)
+				remoteFile, err := openLimited(downloadLimiter, client, ccmBaseUrl, workspaceId, componentId, pathToDownload)
 				if err != nil {
-					// We try one more time with a small timeout
-					<-time.After(10 * time.Millisecond)
-					remoteFile, err = Open(client, ccmBaseUrl, workspaceId, componentId, pathToDownload)
-					if err != nil {
-						panic(err)
-					}
+					panic(err)
 				}
 
 				scmInfo := remoteFile.info.ScmInfo
@@ -413,57 +581,130 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 				localSandboxPath := filepath.FromSlash(pathToDownload)
 
 				// Optimization: State ID is the same as last time and there were no local modifications
-				if status != nil && !status.Modified[localSandboxPath] && !status.Deleted[localSandboxPath] {
+				if status != nil && !status.Modified[localSandboxPath] && !status.Deleted[localSandboxPath] && !status.movedAway(localSandboxPath) {
 					prevMeta, ok := status.metaData.get(localPath, sandbox)
 
 					if ok && prevMeta.StateId == scmInfo.StateId {
 						// Push the old metadata forward for this file
 						remoteFile.Close()
+						if pristine != nil && prevMeta.LinkTarget == "" {
+							keepPristine(pristine, localPath, newMetaData.eolStyleFor(localSandboxPath), prevMeta.Hash)
+						}
 						newMetaData.put(prevMeta, sandbox)
 						workTracker <- false
 						continue
 					}
 				}
 
+				// Symbolic links are loaded as links, there is no content to download
+				if remoteFile.info.Attributes.SymbolicLink {
+					remoteFile.Close()
+
+					err = createLocalLink(sandbox, localPath, remoteFile.info.LinkTarget)
+					if err != nil {
+						panic(err)
+					}
+
+					meta := metaObject{
+						Path:        localPath,
+						ItemId:      scmInfo.ItemId,
+						StateId:     scmInfo.StateId,
+						ComponentId: scmInfo.ComponentId,
+						LinkTarget:  remoteFile.info.LinkTarget,
+					}
+
+					newMetaData.put(meta, sandbox)
+					emit(Event{Type: EVENT_FILE_DOWNLOADED, Phase: "load", Path: pathToDownload})
+					workTracker <- false
+					continue
+				}
+
+				// Don't write the contents through a symbolic link that is in the way
+				stat, _ := os.Lstat(localPath)
+				if stat != nil && isSymlink(stat) {
+					os.Remove(localPath)
+				}
+
+				eol := newMetaData.eolStyleFor(localSandboxPath)
+
+				// Take the contents from the cache that is shared with the other sandboxes
+				if objects != nil {
+					if hash, objectPath, ok := objects.lookup(scmInfo.ItemId, scmInfo.StateId); ok {
+						remoteFile.Close()
+
+						hash, err = objects.place(objectPath, hash, localPath, eol)
+						if err != nil {
+							panic(err)
+						}
+						if pristine != nil {
+							keepPristine(pristine, localPath, eol, hash)
+						}
+
+						emit(Event{Type: EVENT_FILE_DOWNLOADED, Phase: "load", Path: pathToDownload})
+						newMetaData.put(downloadedMeta(localPath, scmInfo, hash), sandbox)
+						workTracker <- false
+						continue
+					}
+				}
+
 				localFile, err := os.Create(filepath.Join(sandbox, pathToDownload))
 				if err != nil {
 					panic(err)
 				}
 
-				// Setup the SHA-1 hash of the file contents
+				// Setup the SHA-1 hash of the file contents. The hash is always
+				//  calculated on the normalized contents so that line delimiter
+				//  conversions don't show up as modifications. The cache gets the
+				//  contents as they are in the repository.
 				hash := sha1.New()
-				tee := io.MultiWriter(localFile, hash)
+				rawHash := sha1.New()
+				var remoteContents io.Reader = remoteFile
+				var cached *cacheWriter
+				if objects != nil {
+					cached, _ = objects.newWriter()
+				}
+				if cached != nil {
+					remoteContents = io.TeeReader(remoteFile, io.MultiWriter(rawHash, cached))
+				}
+				tee := io.TeeReader(normalizeEol(remoteContents, eol), hash)
 
-				numBytes, err := io.Copy(tee, remoteFile)
+				downloadLimiter.acquire()
+				numBytes, err := io.Copy(localFile, localizeEol(tee, eol))
+				downloadLimiter.release(0, err)
 				if err != nil {
+					if cached != nil {
+						cached.abort()
+					}
 					panic(err)
 				}
 
 				workTransfer <- numBytes
+				emit(Event{Type: EVENT_FILE_DOWNLOADED, Phase: "load", Path: pathToDownload, Bytes: numBytes})
 
 				localFile.Close()
 				remoteFile.Close()
 
-				stat, _ := os.Stat(localPath)
+				encodedHash := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+
+				// The cache is only an optimization, the load carries on without it
+				if cached != nil {
+					cached.commit(scmInfo.ItemId, scmInfo.StateId, base64.StdEncoding.EncodeToString(rawHash.Sum(nil)))
+				}
 
-				meta := metaObject{
-					Path:         localPath,
-					ItemId:       scmInfo.ItemId,
-					StateId:      scmInfo.StateId,
-					ComponentId:  scmInfo.ComponentId,
-					LastModified: stat.ModTime().Unix(),
-					Size:         stat.Size(),
-					Hash:         base64.StdEncoding.EncodeToString(hash.Sum(nil)),
+				if pristine != nil {
+					keepPristine(pristine, localPath, eol, encodedHash)
 				}
 
-				newMetaData.put(meta, sandbox)
+				newMetaData.put(downloadedMeta(localPath, scmInfo, encodedHash), sandbox)
 
 				workTracker <- false
 			}
 		}
 	}
 
-	for i := 0; i < numGoRoutines; i++ {
+	// Enough download routines for the largest number of concurrent downloads that the limiter allows
+	numDownloaders := downloadLimiter.workers()
+	for i := 0; i < numDownloaders; i++ {
 		go downloadFiles()
 	}
 
@@ -473,7 +714,7 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 		if file.info.Directory {
 			workTracker <- true
 			// Create if it doesn't already exist
-			stat, _ := os.Stat(localPath)
+			stat, _ := os.Lstat(localPath)
 
 			if stat == nil {
 				err := os.MkdirAll(localPath, 0700)
@@ -481,7 +722,7 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 					return err
 				}
 			} else if !stat.IsDir() {
-				// Weird, there's a file with the same name as the directory in the workspace here
+				// Weird, there's a file (or link) with the same name as the directory in the workspace here
 				os.Remove(localPath)
 				err := os.MkdirAll(localPath, 0700)
 				if err != nil {
@@ -508,7 +749,7 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 
 					if !existsOnRemote {
 						localChildPath := filepath.Join(localPath, localChild)
-						ignored, err := IsIgnored(localChildPath)
+						ignored, err := ignores.ignored(localChildPath)
 						if err != nil {
 							return err
 						}
@@ -537,17 +778,18 @@ func loadComponent(client *Client, ccmBaseUrl string, workspaceId string, compon
 	})
 
 	// Send the stop signal to all download routines
-	for i := 0; i < numGoRoutines; i++ {
+	for i := 0; i < numDownloaders; i++ {
 		downloadQueue <- ""
 		<-finished
 	}
 
 	// Tell the tracker to finish reporting its status
 	trackerFinish <- true
-	// Complete the newline for the progress tracker
-	fmt.Printf("\n")
+	totals := <-trackerTotals
 
 	if err != nil {
 		panic(err)
 	}
+
+	return totals
 }
@@ -90,6 +90,10 @@ func getCredentials() (string, string, error) {
 
 	f, err := os.Open(credentialFilePath)
 	if err != nil {
+		if jsonOutput() {
+			return "", "", simpleWarning("We need your credentials for this operation. Use the 'gojazz login' command first.")
+		}
+
 		fmt.Printf("We need your credentials for this operation.")
 		fmt.Printf("You can avoid this prompt next time by using the 'gojazz login' command.\n")
 		fmt.Println()
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 
 	"runtime/debug"
 )
@@ -26,16 +27,51 @@ func errorFromResponse(response *http.Response) *JazzError {
 	return &JazzError{Msg: response.Status, StatusCode: response.StatusCode, Details: requestString + string(b), Log: response.StatusCode > 499}
 }
 
+// Exit code when a command fails
+const exitError = 2
+
+var subcommands = []string{"load", "status", "checkin", "sync", "accept", "deliver", "autosync", "build", "mv", "diff", "revert", "resolve", "backup", "component", "changeset", "export", "compare", "cache", "login"}
+
+// The subcommands as a readable list, e.g. 'load', 'status' and 'login'
+func availableSubcommands() string {
+	quoted := []string{}
+	for _, subcommand := range subcommands {
+		quoted = append(quoted, "'"+subcommand+"'")
+	}
+
+	last := len(quoted) - 1
+	return strings.Join(quoted[:last], ", ") + " and " + quoted[last]
+}
+
 func simpleWarning(msg string) *JazzError {
 	return &JazzError{Msg: msg, Log: false}
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("No subcommand provided. Available subcommands: 'load', 'status', 'sync', 'build' and 'login'\n")
-		return
+// Options that apply to every subcommand are taken out of the arguments
+// before the subcommand parses its own options.
+func parseGlobalOptions() {
+	args := []string{}
+
+	for idx, arg := range os.Args {
+		// Everything after "--" belongs to someone else (e.g. the build command)
+		if arg == "--" {
+			args = append(args, os.Args[idx:]...)
+			break
+		}
+
+		trimmed := strings.TrimLeft(arg, "-")
+		if idx > 0 && strings.HasPrefix(arg, "-") && strings.HasPrefix(trimmed, "output=") {
+			setOutput(strings.TrimPrefix(trimmed, "output="))
+			continue
+		}
+
+		args = append(args, arg)
 	}
 
+	os.Args = args
+}
+
+func main() {
 	// Error handling and log file dump routine
 	defer func() {
 		r := recover()
@@ -45,47 +81,57 @@ func main() {
 			return
 		}
 
+		// Scripts can tell failures apart from the exit codes of successful commands
+		defer os.Exit(exitError)
+
 		jazzError, ok := r.(*JazzError)
 		if ok {
 			// First, check to see if it a well known status code
 			if jazzError.StatusCode == 401 {
-				fmt.Printf("Error: Unauthorized. Use the login command to set your credentials.\n")
+				emit(Event{Type: EVENT_ERROR, Message: "Error: Unauthorized. Use the login command to set your credentials."})
 				return
 			}
 
 			if jazzError.StatusCode == 403 {
-				fmt.Printf("Error: Forbidden. You are not allowed access.\n")
+				emit(Event{Type: EVENT_ERROR, Message: "Error: Forbidden. You are not allowed access."})
 				return
 			}
 
 			if jazzError.StatusCode == 404 {
-				fmt.Printf("Error: Not Found. Check the name and spelling and try again.\n")
+				emit(Event{Type: EVENT_ERROR, Message: "Error: Not Found. Check the name and spelling and try again."})
 				return
 			}
 
 			if jazzError.Log {
-				fmt.Printf("ERROR: %v\n", jazzError.Msg)
+				emit(Event{Type: EVENT_ERROR, Message: fmt.Sprintf("ERROR: %v", jazzError.Msg)})
 				logfile, err := ioutil.TempFile("", "gojazz-log")
 				if err == nil {
-					fmt.Printf("Writing details of this problem to %v\n", logfile.Name())
+					emitMessage("Writing details of this problem to %v", logfile.Name())
 					logfile.Write([]byte(fmt.Sprintf("ERROR: %v\n", r)))
 					logfile.Write([]byte(fmt.Sprintf("DETAILS: %v\n", jazzError.Details)))
 					logfile.Write(debug.Stack())
 				}
 			} else {
-				fmt.Printf("%v\n", jazzError.Msg)
+				emit(Event{Type: EVENT_ERROR, Message: jazzError.Msg})
 			}
 		} else {
-			fmt.Printf("ERROR: %v\n", r)
+			emit(Event{Type: EVENT_ERROR, Message: fmt.Sprintf("ERROR: %v", r)})
 			logfile, err := ioutil.TempFile("", "gojazz-log")
 			if err == nil {
-				fmt.Printf("Writing details of this problem to %v\n", logfile.Name())
+				emitMessage("Writing details of this problem to %v", logfile.Name())
 				logfile.Write([]byte(fmt.Sprintf("ERROR: %v\n", r)))
 				logfile.Write(debug.Stack())
 			}
 		}
 	}()
 
+	parseGlobalOptions()
+
+	if len(os.Args) < 2 {
+		emitWarning("No subcommand provided. Available subcommands: %v", availableSubcommands())
+		return
+	}
+
 	switch os.Args[1] {
 	case "load":
 		os.Args = os.Args[1:]
@@ -99,6 +145,12 @@ func main() {
 	case "sync":
 		os.Args = os.Args[1:]
 		syncOp()
+	case "accept":
+		os.Args = os.Args[1:]
+		acceptOp()
+	case "deliver":
+		os.Args = os.Args[1:]
+		deliverOp()
 	case "login":
 		os.Args = os.Args[1:]
 		loginOp()
@@ -108,7 +160,37 @@ func main() {
 	case "autosync":
 		os.Args = os.Args[1:]
 		autosyncOp()
+	case "cache":
+		os.Args = os.Args[1:]
+		cacheOp()
+	case "export":
+		os.Args = os.Args[1:]
+		exportOp()
+	case "compare":
+		os.Args = os.Args[1:]
+		compareOp()
+	case "mv":
+		os.Args = os.Args[1:]
+		mvOp()
+	case "diff":
+		os.Args = os.Args[1:]
+		diffOp()
+	case "revert":
+		os.Args = os.Args[1:]
+		revertOp()
+	case "component":
+		os.Args = os.Args[1:]
+		componentOp()
+	case "changeset":
+		os.Args = os.Args[1:]
+		changesetOp()
+	case "resolve":
+		os.Args = os.Args[1:]
+		resolveOp()
+	case "backup":
+		os.Args = os.Args[1:]
+		backupOp()
 	default:
-		fmt.Printf("Invalid subcommand '%v'. Available subcommands: 'load', 'status', 'sync', 'autosync', 'build' and 'login'\n", os.Args[1])
+		emitWarning("Invalid subcommand '%v'. Available subcommands: %v", os.Args[1], availableSubcommands())
 	}
 }
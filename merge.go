@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	conflictStart  = "<<<<<<< mine\n"
+	conflictMiddle = "=======\n"
+	conflictEnd    = ">>>>>>> theirs\n"
+)
+
+// Merge the changes from the base to mine and from the base to theirs line by
+// line. Regions that both sides changed differently are written with conflict
+// markers. Returns the merged lines and the number of conflicting regions.
+func mergeLines(base []string, mine []string, theirs []string) ([]string, int) {
+	matchMine := matchBase(base, mine)
+	matchTheirs := matchBase(base, theirs)
+
+	merged := []string{}
+	conflicts := 0
+
+	i, a, b := 0, 0, 0
+	for i < len(base) || a < len(mine) || b < len(theirs) {
+		// Lines that neither side touched
+		if i < len(base) && matchMine[i] == a && matchTheirs[i] == b {
+			merged = append(merged, base[i])
+			i, a, b = i+1, a+1, b+1
+			continue
+		}
+
+		// The changed region ends at the next base line that both sides kept
+		next := i
+		for next < len(base) && (matchMine[next] == -1 || matchTheirs[next] == -1) {
+			next++
+		}
+		nextMine, nextTheirs := len(mine), len(theirs)
+		if next < len(base) {
+			nextMine, nextTheirs = matchMine[next], matchTheirs[next]
+		}
+
+		baseRegion := base[i:next]
+		mineRegion := mine[a:nextMine]
+		theirsRegion := theirs[b:nextTheirs]
+
+		switch {
+		case equalLines(mineRegion, baseRegion):
+			merged = append(merged, theirsRegion...)
+		case equalLines(theirsRegion, baseRegion), equalLines(mineRegion, theirsRegion):
+			merged = append(merged, mineRegion...)
+		default:
+			merged = append(merged, conflictStart)
+			merged = append(merged, terminated(mineRegion)...)
+			merged = append(merged, conflictMiddle)
+			merged = append(merged, terminated(theirsRegion)...)
+			merged = append(merged, conflictEnd)
+			conflicts++
+		}
+
+		i, a, b = next, nextMine, nextTheirs
+	}
+
+	return merged, conflicts
+}
+
+// For each line of the base, the index of the same line in the other version
+// when it was kept or -1 when it was changed
+func matchBase(base []string, other []string) []int {
+	match := make([]int, len(base))
+
+	i, j := 0, 0
+	for _, op := range diffLines(base, other) {
+		switch op.kind {
+		case ' ':
+			match[i] = j
+			i++
+			j++
+		case '-':
+			match[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+
+	return match
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, _ := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The last line before a conflict marker needs a line delimiter
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+
+	result := append([]string{}, lines[:len(lines)-1]...)
+	return append(result, lines[len(lines)-1]+"\n")
+}
+
+func hasConflictMarkers(contents []byte) bool {
+	for _, line := range splitLines(string(contents)) {
+		if line == conflictStart || line == conflictEnd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Merge the files that changed both in the sandbox and in the repository
+// workspace. Each file ends up based on the version in the repository
+// workspace with the local changes merged in, the local versions are backed up
+// first. Files with conflicting changes, and binary files and links that can't
+// be merged, are kept as unresolved conflicts until they are resolved with the
+// resolve command. Returns the files that merged cleanly.
+func mergeConflicts(client *Client, status *status, sandboxPath string, conflicts []string) []string {
+	metadata := status.metaData
+	base := &baseReader{metadata: metadata, pristine: metadata.pristineStore(sandboxPath), client: client}
+
+	if metadata.conflicts == nil {
+		metadata.conflicts = make(map[string]bool)
+	}
+
+	backup := newStatus(sandboxPath, BACKUP)
+	backup.metaData = metadata
+
+	clean := []string{}
+	for _, rel := range conflicts {
+		// The new version is loaded in place of the deleted file
+		if status.Deleted[rel] {
+			emitWarning("%v was deleted in the sandbox but changed in the repository workspace. The new version is loaded again.", rel)
+			continue
+		}
+
+		meta := metadata.pathMap[rel]
+		localPath := filepath.Join(sandboxPath, rel)
+		eol := metadata.eolStyleFor(rel)
+
+		remoteFile, err := Open(client, metadata.ccmBaseUrl, metadata.workspaceId, meta.ComponentId, filepath.ToSlash(rel))
+		if err != nil {
+			panic(err)
+		}
+		theirsMeta := meta
+		theirsMeta.StateId = remoteFile.info.ScmInfo.StateId
+		theirsMeta.ModTimeNano = 0
+		theirsMeta.Inode = 0
+		theirsMeta.ChangeTimeNano = 0
+
+		var theirs []byte
+		if remoteFile.info.Attributes.SymbolicLink {
+			remoteFile.Close()
+			theirs = []byte(remoteFile.info.LinkTarget)
+			theirsMeta.LinkTarget = remoteFile.info.LinkTarget
+		} else {
+			theirs = readRemote(*remoteFile)
+		}
+
+		info, err := os.Lstat(localPath)
+		if err != nil {
+			panic(err)
+		}
+		backup.fileModified(meta, localPath, sandboxPath)
+
+		mine := readLocal(localPath, eol)
+		original := base.read(meta, rel)
+
+		// The sandbox now has the version of the repository workspace as its
+		//  loaded version, with the local changes on top
+		if theirsMeta.LinkTarget == "" {
+			hash := sha1.Sum(theirs)
+			theirsMeta.Hash = base64.StdEncoding.EncodeToString(hash[:])
+			theirsMeta.Size = int64(len(theirs))
+		}
+		metadata.pathMap[rel] = theirsMeta
+
+		if isSymlink(info) || meta.LinkTarget != "" || theirsMeta.LinkTarget != "" || isBinary(mine) || isBinary(theirs) || isBinary(original) {
+			metadata.conflicts[rel] = true
+			emit(Event{Type: EVENT_CHANGE, Phase: "merge", Path: filepath.ToSlash(rel), Change: "Conflict, choose -mine or -theirs"})
+			continue
+		}
+
+		lines, conflicting := mergeLines(splitLines(string(original)), splitLines(string(mine)), splitLines(string(theirs)))
+
+		file, err := os.Create(localPath)
+		if err != nil {
+			panic(err)
+		}
+		_, err = io.Copy(file, localizeEol(bytes.NewReader([]byte(strings.Join(lines, ""))), eol))
+		file.Close()
+		if err != nil {
+			panic(err)
+		}
+
+		if conflicting > 0 {
+			metadata.conflicts[rel] = true
+			emit(Event{Type: EVENT_CHANGE, Phase: "merge", Path: filepath.ToSlash(rel), Change: "Conflict"})
+			continue
+		}
+
+		emit(Event{Type: EVENT_CHANGE, Phase: "merge", Path: filepath.ToSlash(rel), Change: "Merged"})
+		clean = append(clean, rel)
+	}
+
+	if !backup.unchanged() {
+		saved, err := backup.saveBackup("sync")
+		if err != nil {
+			panic(err)
+		}
+		emitWarning("Your versions of the merged files have been backed up to this location: %v", saved.dir)
+	}
+
+	err := metadata.save(filepath.Join(sandboxPath, metadataFileName))
+	if err != nil {
+		panic(err)
+	}
+
+	return clean
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		base, mine, theirs string
+		merged             string
+		conflicts          int
+	}{
+		// Changes to different lines are both kept
+		{"a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", 0},
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nx\nb\nc\n", "a\nx\nb\nc\n", 0},
+		{"a\nb\nc\n", "a\nc\n", "a\nb\nc\nd", "a\nc\nd", 0},
+		// The same change on both sides isn't a conflict
+		{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", 0},
+		// Different changes to the same line are
+		{"a\nb\nc\n", "a\nmine\nc\n", "a\ntheirs\nc\n", "a\n" + conflictStart + "mine\n" + conflictMiddle + "theirs\n" + conflictEnd + "c\n", 1},
+		{"a\n", "a\nmine", "a\ntheirs", "a\n" + conflictStart + "mine\n" + conflictMiddle + "theirs\n" + conflictEnd, 1},
+	}
+
+	for _, test := range tests {
+		lines, conflicts := mergeLines(splitLines(test.base), splitLines(test.mine), splitLines(test.theirs))
+		merged := strings.Join(lines, "")
+
+		if merged != test.merged || conflicts != test.conflicts {
+			t.Errorf("Unexpected merge of %q, %q and %q: %q with %v conflicts", test.base, test.mine, test.theirs, merged, conflicts)
+		}
+	}
+
+	if !hasConflictMarkers([]byte("a\n"+conflictStart+"b\n")) || hasConflictMarkers([]byte("a\n<<<<<<<\n")) {
+		t.Error("Unexpected detection of the conflict markers")
+	}
+}
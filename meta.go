@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/gob"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -19,16 +20,33 @@ type metaObject struct {
 	Size         int64
 	Hash         string
 	ComponentId  string
+	LinkTarget   string
+
+	// Stat information of the local file when its hash was recorded
+	ModTimeNano    int64
+	Inode          uint64
+	ChangeTimeNano int64
 }
 
 type metaData struct {
 	pathMap       map[string]metaObject
 	componentEtag map[string]string
 	isstream      bool
+	readonly      bool
 	ccmBaseUrl    string
 	workspaceId   string
 	projectName   string
 	userId        string
+	eolRules      []eolRule
+
+	// Moves recorded with the mv command from the new path to the loaded one
+	moves map[string]string
+	// Keep compressed copies of the loaded files in the sandbox
+	pristine bool
+	// Files merged by sync with conflicts that aren't resolved yet
+	conflicts map[string]bool
+	// Components for new items by their path prefix in the sandbox
+	componentRules map[string]string
 
 	inited    bool
 	storeMeta chan metaObject
@@ -40,6 +58,9 @@ func newMetaData() *metaData {
 
 	metadata.pathMap = make(map[string]metaObject)
 	metadata.componentEtag = make(map[string]string)
+	metadata.moves = make(map[string]string)
+	metadata.conflicts = make(map[string]bool)
+	metadata.componentRules = make(map[string]string)
 
 	metadata.inited = false
 
@@ -59,6 +80,27 @@ func (metadata *metaData) load(path string) error {
 		err = decoder.Decode(&metadata.userId)
 		err = decoder.Decode(&metadata.pathMap)
 		err = decoder.Decode(&metadata.componentEtag)
+
+		// Settings added after the original format are optional so that
+		//  older sandboxes can still be read.
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.eolRules)
+		}
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.readonly)
+		}
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.moves)
+		}
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.pristine)
+		}
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.conflicts)
+		}
+		if err == nil {
+			err = decodeOptional(decoder, &metadata.componentRules)
+		}
 	}
 
 	return err
@@ -82,6 +124,21 @@ func (metadata *metaData) save(path string) error {
 		err = encoder.Encode(&metadata.userId)
 		err = encoder.Encode(&metadata.pathMap)
 		err = encoder.Encode(&metadata.componentEtag)
+		err = encoder.Encode(&metadata.eolRules)
+		err = encoder.Encode(&metadata.readonly)
+		err = encoder.Encode(&metadata.moves)
+		err = encoder.Encode(&metadata.pristine)
+		err = encoder.Encode(&metadata.conflicts)
+		err = encoder.Encode(&metadata.componentRules)
+	}
+
+	return err
+}
+
+func decodeOptional(decoder *gob.Decoder, e interface{}) error {
+	err := decoder.Decode(e)
+	if err == io.EOF {
+		return nil
 	}
 
 	return err
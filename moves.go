@@ -0,0 +1,457 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func mvDefaults() {
+	fmt.Printf("gojazz mv <source> <destination>\n")
+	flag.PrintDefaults()
+}
+
+// Move a file or folder in the sandbox and remember where it came from, so that
+// the check-in moves the item in the repository instead of replacing it.
+func mvOp() {
+	flag.Usage = mvDefaults
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		emitWarning("Provide the file or folder to move and its new location and try again.")
+		mvDefaults()
+		return
+	}
+
+	source, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	destination, err := filepath.Abs(flag.Arg(1))
+	if err != nil {
+		panic(err)
+	}
+
+	// Like mv, moving into an existing folder keeps the name
+	info, err := os.Stat(destination)
+	if err == nil && info.IsDir() {
+		destination = filepath.Join(destination, filepath.Base(source))
+	}
+
+	sandboxPath := findSandbox(filepath.Dir(source))
+	metadata := newMetaData()
+	err = metadata.load(filepath.Join(sandboxPath, metadataFileName))
+	if err != nil {
+		panic(simpleWarning("Not a sandbox"))
+	}
+
+	from, err := filepath.Rel(sandboxPath, source)
+	if err != nil {
+		panic(err)
+	}
+	to, err := filepath.Rel(sandboxPath, destination)
+	if err != nil {
+		panic(err)
+	}
+	if !inSandbox(from) || !inSandbox(to) {
+		panic(simpleWarning("Both locations must be inside the sandbox at " + sandboxPath))
+	}
+
+	if _, ok := metadata.movedOrigin(from); !ok {
+		panic(simpleWarning(flag.Arg(0) + " isn't in the repository, move it like any other file."))
+	}
+
+	_, err = os.Lstat(destination)
+	if err == nil {
+		panic(simpleWarning(flag.Arg(1) + " already exists."))
+	}
+
+	err = os.Rename(source, destination)
+	if err != nil {
+		panic(err)
+	}
+
+	metadata.recordMove(from, to)
+
+	err = metadata.save(filepath.Join(sandboxPath, metadataFileName))
+	if err != nil {
+		panic(err)
+	}
+
+	emit(Event{Type: EVENT_CHANGE, Phase: "mv", Path: to, From: from, Change: "Moved"})
+}
+
+func inSandbox(rel string) bool {
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Check whether the path is the folder or inside of it
+func isWithin(rel string, folder string) bool {
+	return rel == folder || strings.HasPrefix(rel, folder+string(filepath.Separator))
+}
+
+// The path that was loaded for the item at the path, following the recorded
+// moves of the item and its parent folders.
+func (metadata *metaData) movedOrigin(rel string) (string, bool) {
+	origin := rel
+
+	for dir := rel; dir != "."; dir = filepath.Dir(dir) {
+		if from, ok := metadata.moves[dir]; ok {
+			origin = from + rel[len(dir):]
+			break
+		}
+	}
+
+	_, ok := metadata.pathMap[origin]
+	return origin, ok
+}
+
+// Remember that the item was moved. Moves recorded for the item or its contents
+// are carried along to the new location.
+func (metadata *metaData) recordMove(from string, to string) {
+	origin, _ := metadata.movedOrigin(from)
+
+	if metadata.moves == nil {
+		metadata.moves = make(map[string]string)
+	}
+
+	recorded := false
+	for dest, src := range metadata.moves {
+		if !isWithin(dest, from) {
+			continue
+		}
+		if dest == from {
+			recorded = true
+		}
+
+		delete(metadata.moves, dest)
+		if moved := to + dest[len(from):]; moved != src {
+			metadata.moves[moved] = src
+		}
+	}
+
+	if !recorded && origin != to {
+		metadata.moves[to] = origin
+	}
+}
+
+// Move the entries of the item and its contents to the new path
+func (metadata *metaData) renamePath(from string, to string) {
+	for p, meta := range metadata.pathMap {
+		if !isWithin(p, from) {
+			continue
+		}
+
+		delete(metadata.pathMap, p)
+		meta.Path = to + p[len(from):]
+		metadata.pathMap[meta.Path] = meta
+	}
+
+	delete(metadata.moves, to)
+}
+
+// The current path of the item in the metadata
+func (metadata *metaData) pathOf(itemId string) (string, bool) {
+	for p, meta := range metadata.pathMap {
+		if meta.ItemId == itemId {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// Pair up deleted and added items that are really the same item in a new place.
+// Moves recorded with the mv command come first, then files with the same
+// contents are matched.
+func (status *status) detectMoves() error {
+	metadata := status.metaData
+
+	for to, from := range metadata.moves {
+		meta, ok := metadata.pathMap[from]
+		if !ok || !status.Deleted[from] || !status.Added[to] || !status.sameComponent(meta, to) {
+			continue
+		}
+
+		path := filepath.Join(status.sandboxPath, to)
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+
+		folder := meta.Hash == "" && meta.LinkTarget == ""
+		if folder != (info.IsDir() && !isSymlink(info)) {
+			continue
+		}
+
+		status.pairMove(from, to)
+
+		if !folder {
+			err = status.checkMovedContents(meta, to)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The contents move along with the folder
+		for deleted, _ := range status.Deleted {
+			if !isWithin(deleted, from) {
+				continue
+			}
+			moved := to + deleted[len(from):]
+			if !status.Added[moved] {
+				continue
+			}
+
+			delete(status.Deleted, deleted)
+			delete(status.Added, moved)
+
+			err = status.checkMovedContents(metadata.pathMap[deleted], moved)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Candidates for the remaining added files, empty files are all the same
+	byHash := make(map[string][]string)
+	sizes := make(map[int64]bool)
+	for from, _ := range status.Deleted {
+		meta := metadata.pathMap[from]
+		if meta.Hash == "" || meta.LinkTarget != "" || meta.Size == 0 {
+			continue
+		}
+
+		byHash[meta.Hash] = append(byHash[meta.Hash], from)
+		sizes[meta.Size] = true
+	}
+	if len(byHash) == 0 {
+		return nil
+	}
+
+	jobs := []hashJob{}
+	for to, _ := range status.Added {
+		path := filepath.Join(status.sandboxPath, to)
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
+
+		eol := metadata.eolStyleFor(to)
+		if eol == EOL_NONE && !sizes[info.Size()] {
+			continue
+		}
+
+		jobs = append(jobs, hashJob{path: path, eol: eol, info: info})
+	}
+
+	hashes := make(map[string]string)
+	for result := range hashFiles(jobs) {
+		if result.err != nil {
+			// The file can still be checked in as an added file
+			continue
+		}
+
+		rel, err := filepath.Rel(status.sandboxPath, result.job.path)
+		if err != nil {
+			return err
+		}
+		hashes[rel] = result.hash
+	}
+
+	added := []string{}
+	for to, _ := range hashes {
+		added = append(added, to)
+	}
+	sort.Strings(added)
+
+	for _, to := range added {
+		candidates := byHash[hashes[to]]
+		sort.Strings(candidates)
+
+		// Prefer a file with the same name, it was most likely moved and not copied
+		from := ""
+		for _, candidate := range candidates {
+			if !status.Deleted[candidate] || !status.sameComponent(metadata.pathMap[candidate], to) {
+				continue
+			}
+			if from == "" || (filepath.Base(candidate) == filepath.Base(to) && filepath.Base(from) != filepath.Base(to)) {
+				from = candidate
+			}
+		}
+
+		if from != "" {
+			status.pairMove(from, to)
+		}
+	}
+
+	return nil
+}
+
+func (status *status) pairMove(from string, to string) {
+	delete(status.Deleted, from)
+	delete(status.Added, to)
+	status.Moved[to] = from
+}
+
+// A moved item with different contents is also modified. It was already staged
+// when it was found as an added item.
+func (status *status) checkMovedContents(meta metaObject, to string) error {
+	path := filepath.Join(status.sandboxPath, to)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	modified := false
+	if info.IsDir() && !isSymlink(info) {
+		return nil
+	} else if isSymlink(info) || meta.LinkTarget != "" {
+		modified = meta.LinkTarget == ""
+		if !modified {
+			modified, err = linkModified(meta, path, info)
+		}
+	} else {
+		hash := ""
+		hash, err = hashLocalFile(path, status.metaData.eolStyleFor(to))
+		modified = hash != meta.Hash
+	}
+	if err != nil {
+		return err
+	}
+
+	if modified {
+		status.Modified[to] = true
+	}
+
+	return nil
+}
+
+// Items can only move inside of their component. The new location belongs to
+// the component of its closest folder that is already in the repository.
+func (status *status) sameComponent(meta metaObject, to string) bool {
+	for dir := filepath.Dir(to); dir != "."; dir = filepath.Dir(dir) {
+		if from, ok := status.Moved[dir]; ok {
+			return status.metaData.pathMap[from].ComponentId == meta.ComponentId
+		}
+		if parent, ok := status.metaData.pathMap[dir]; ok && !status.Added[dir] {
+			return parent.ComponentId == meta.ComponentId
+		}
+	}
+
+	return true
+}
+
+// Check whether the item at the loaded path is somewhere else now
+func (status *status) movedAway(rel string) bool {
+	for _, from := range status.Moved {
+		if isWithin(rel, from) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Move the items in the repository so that they keep their history. The
+// metadata follows each move, including the contents of moved folders.
+func checkinMoves(client *Client, status *status, sandboxPath string) int {
+	workspaceId := status.metaData.workspaceId
+	ccmBaseUrl := status.metaData.ccmBaseUrl
+	metadata := status.metaData
+
+	destinations := []string{}
+	items := make(map[string]metaObject)
+	for to, from := range status.Moved {
+		destinations = append(destinations, to)
+		items[to] = metadata.pathMap[from]
+	}
+
+	// Parent folders are in place before their contents arrive
+	sort.Strings(destinations)
+
+	moved := 0
+	for _, to := range destinations {
+		item := items[to]
+		componentId := item.ComponentId
+
+		// An earlier move may have taken the item along with its folder
+		from, ok := metadata.pathOf(item.ItemId)
+		if !ok {
+			panic(&JazzError{Msg: "Metadata not found for moved item discovered in the metadata.", Log: true})
+		}
+
+		parent := filepath.Dir(to)
+		if _, ok := metadata.pathMap[parent]; parent != "." && !ok {
+			_, err := MkdirAll(client, ccmBaseUrl, workspaceId, componentId, filepath.ToSlash(parent))
+			if err != nil {
+				panic(err)
+			}
+			moved += checkinMovedParents(client, status, sandboxPath, componentId, parent)
+		}
+
+		remoteFile, err := Move(client, ccmBaseUrl, workspaceId, componentId, filepath.ToSlash(from), filepath.ToSlash(to))
+		if err != nil {
+			fileerror, ok := err.(*JazzError)
+			if !ok || fileerror.StatusCode != 404 || (item.Hash == "" && item.LinkTarget == "") {
+				panic(err)
+			}
+
+			// Fall back to replacing the file
+			emitWarning("Cannot move %v on the remote since it no longer exists there. It will be added as a new file.", from)
+			delete(status.Moved, to)
+			delete(status.Modified, to)
+			status.Deleted[from] = true
+			status.Added[to] = true
+			continue
+		}
+
+		metadata.renamePath(from, to)
+
+		meta := metadata.pathMap[to]
+		meta.StateId = remoteFile.info.ScmInfo.StateId
+		metadata.pathMap[to] = meta
+
+		// Deleted contents of a moved folder are deleted from the new location
+		for deleted, _ := range status.Deleted {
+			if isWithin(deleted, from) {
+				delete(status.Deleted, deleted)
+				status.Deleted[to+deleted[len(from):]] = true
+			}
+		}
+
+		emit(Event{Type: EVENT_FILE_CHECKED_IN, Phase: "checkin", Path: to, From: from, Change: "Moved"})
+		moved++
+	}
+
+	return moved
+}
+
+// Record the new folders that were created for a move so that they aren't
+// added again.
+func checkinMovedParents(client *Client, status *status, sandboxPath string, componentId string, parent string) int {
+	added := 0
+	for dir := parent; dir != "." && status.Added[dir]; dir = filepath.Dir(dir) {
+		remoteFolder, err := Open(client, status.metaData.ccmBaseUrl, status.metaData.workspaceId, componentId, filepath.ToSlash(dir))
+		if err != nil {
+			panic(err)
+		}
+
+		meta := metaObject{}
+		meta.Path = filepath.Join(sandboxPath, dir)
+		meta.ItemId = remoteFolder.info.ScmInfo.ItemId
+		meta.StateId = remoteFolder.info.ScmInfo.StateId
+		meta.ComponentId = remoteFolder.info.ScmInfo.ComponentId
+		status.metaData.simplePut(meta, sandboxPath)
+
+		delete(status.Added, dir)
+		emit(Event{Type: EVENT_FILE_CHECKED_IN, Phase: "checkin", Path: dir, Change: "Added"})
+		added++
+	}
+
+	return added
+}
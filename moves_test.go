@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordMove(t *testing.T) {
+	md := newMetaData()
+	md.pathMap["a.txt"] = metaObject{ItemId: "a", Hash: "x"}
+	md.pathMap["dir"] = metaObject{ItemId: "dir"}
+	md.pathMap[filepath.Join("dir", "b.txt")] = metaObject{ItemId: "b", Hash: "y"}
+
+	// A chain of moves is recorded from the loaded path
+	md.recordMove("a.txt", "b.txt")
+	md.recordMove("b.txt", "c.txt")
+	if len(md.moves) != 1 || md.moves["c.txt"] != "a.txt" {
+		t.Errorf("Chained moves should be recorded from the loaded path: %v", md.moves)
+	}
+	if origin, ok := md.movedOrigin("c.txt"); !ok || origin != "a.txt" {
+		t.Errorf("Unexpected origin of c.txt: %v %v", origin, ok)
+	}
+
+	// Moving it back forgets the move
+	md.recordMove("c.txt", "a.txt")
+	if len(md.moves) != 0 {
+		t.Errorf("Moving back should forget the move: %v", md.moves)
+	}
+
+	// Moves of the contents are carried along with their folder
+	md.recordMove(filepath.Join("dir", "b.txt"), filepath.Join("dir", "c.txt"))
+	md.recordMove("dir", "lib")
+	if md.moves["lib"] != "dir" || md.moves[filepath.Join("lib", "c.txt")] != filepath.Join("dir", "b.txt") || len(md.moves) != 2 {
+		t.Errorf("The move of the contents should follow the folder: %v", md.moves)
+	}
+	if origin, ok := md.movedOrigin(filepath.Join("lib", "c.txt")); !ok || origin != filepath.Join("dir", "b.txt") {
+		t.Errorf("Unexpected origin of lib/c.txt: %v %v", origin, ok)
+	}
+
+	// Contents of a moved folder that weren't moved themselves come from the old folder
+	md.pathMap[filepath.Join("dir", "d.txt")] = metaObject{ItemId: "d", Hash: "z"}
+	if origin, ok := md.movedOrigin(filepath.Join("lib", "d.txt")); !ok || origin != filepath.Join("dir", "d.txt") {
+		t.Errorf("Unexpected origin of lib/d.txt: %v %v", origin, ok)
+	}
+
+	// A file moved out of the moved folder keeps its loaded path
+	md.recordMove(filepath.Join("lib", "c.txt"), "top.txt")
+	if md.moves["top.txt"] != filepath.Join("dir", "b.txt") || md.moves["lib"] != "dir" || len(md.moves) != 2 {
+		t.Errorf("Unexpected moves after moving out of the folder: %v", md.moves)
+	}
+
+	md.recordMove("lib", "dir")
+	if len(md.moves) != 1 || md.moves["top.txt"] != filepath.Join("dir", "b.txt") {
+		t.Errorf("Moving the folder back should only forget its own move: %v", md.moves)
+	}
+
+	if _, ok := md.movedOrigin("new.txt"); ok {
+		t.Errorf("Files that were never loaded have no origin")
+	}
+}
+
+func TestDetectMoves(t *testing.T) {
+	sandbox, err := ioutil.TempDir("", "gojazz-moves")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	write := func(rel string, contents string) {
+		p := filepath.Join(sandbox, rel)
+		err := os.MkdirAll(filepath.Dir(p), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(contents), 0600)
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	// The hashes of the loaded versions
+	md := newMetaData()
+	loaded := func(rel string, contents string) {
+		write(rel, contents)
+		hash, err := hashLocalFile(filepath.Join(sandbox, rel), EOL_NONE)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		md.pathMap[rel] = metaObject{ItemId: rel, ComponentId: "comp", Hash: hash, Size: int64(len(contents))}
+		os.Remove(filepath.Join(sandbox, rel))
+	}
+	loaded(filepath.Join("a", "other.txt"), "same contents\n")
+	loaded(filepath.Join("b", "same.txt"), "same contents\n")
+	loaded(filepath.Join("src", "main.go"), "package main\n")
+	loaded("empty.txt", "")
+	md.pathMap["src"] = metaObject{ItemId: "src", ComponentId: "comp"}
+	md.recordMove("src", "lib")
+
+	// The folder moved with the mv command and its file changed, the other
+	//  file moved to a new folder
+	write(filepath.Join("lib", "main.go"), "package lib\n")
+	write(filepath.Join("c", "same.txt"), "same contents\n")
+	write("empty2.txt", "")
+
+	status := newStatus(sandbox, NO_COPY)
+	status.metaData = md
+	for _, rel := range []string{filepath.Join("a", "other.txt"), filepath.Join("b", "same.txt"), "src", filepath.Join("src", "main.go"), "empty.txt"} {
+		status.Deleted[rel] = true
+	}
+	for _, rel := range []string{"lib", filepath.Join("lib", "main.go"), "c", filepath.Join("c", "same.txt"), "empty2.txt"} {
+		status.Added[rel] = true
+	}
+
+	err = status.detectMoves()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if status.Moved["lib"] != "src" {
+		t.Errorf("The recorded folder move should be detected: %v", status.Moved)
+	}
+	if status.Deleted[filepath.Join("src", "main.go")] || status.Added[filepath.Join("lib", "main.go")] {
+		t.Errorf("The contents should move with the folder: %v %v", status.Added, status.Deleted)
+	}
+	if !status.Modified[filepath.Join("lib", "main.go")] {
+		t.Errorf("The changed file in the moved folder should be modified: %v", status.Modified)
+	}
+	if status.Moved[filepath.Join("c", "same.txt")] != filepath.Join("b", "same.txt") {
+		t.Errorf("The file with the same name and contents should be the origin: %v", status.Moved)
+	}
+	if !status.Deleted[filepath.Join("a", "other.txt")] {
+		t.Errorf("The other file with the same contents should stay deleted: %v", status.Deleted)
+	}
+	if !status.Deleted["empty.txt"] || !status.Added["empty2.txt"] {
+		t.Errorf("Empty files should not be matched: %v %v", status.Added, status.Deleted)
+	}
+	if !status.Added["c"] || len(status.Moved) != 2 {
+		t.Errorf("Unexpected moves: %v %v", status.Added, status.Moved)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sandboxes can keep compressed copies of the loaded versions of their files so
+// that diff and revert work without network access. Each copy is stored once
+// under the hash of its normalized contents, the same hash as in the metadata,
+// so identical files share a copy.
+const (
+	pristineFolder     = ".jazzpristine"
+	pristineTempPrefix = "store-"
+
+	// Bigger files are fetched from the repository when they are needed
+	maxPristineFileSize = 10 * 1024 * 1024
+)
+
+type pristineStore struct {
+	dir string
+}
+
+// The pristine store of the sandbox, nil when the sandbox doesn't keep one
+func (metadata *metaData) pristineStore(sandbox string) *pristineStore {
+	if !metadata.pristine {
+		return nil
+	}
+
+	return &pristineStore{dir: filepath.Join(sandbox, pristineFolder)}
+}
+
+func (store *pristineStore) objectPath(hash string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", simpleWarning("Missing hash for the pristine copy")
+	}
+	name := hex.EncodeToString(b)
+
+	return filepath.Join(store.dir, name[:2], name+".gz"), nil
+}
+
+// Keep a copy of the local file whose normalized contents have the hash
+func (store *pristineStore) put(localPath string, eol eolStyle, hash string) error {
+	objectPath, err := store.objectPath(hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(objectPath)
+	if err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxPristineFileSize {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(objectPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Concurrent loads of the same contents both end up with a complete copy
+	temp, err := ioutil.TempFile(store.dir, pristineTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err == nil {
+		compressed := gzip.NewWriter(temp)
+		_, err = io.Copy(compressed, normalizeEol(file, eol))
+		file.Close()
+		if err == nil {
+			err = compressed.Close()
+		}
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), objectPath)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+
+	return err
+}
+
+// The normalized contents of the loaded version with the hash
+func (store *pristineStore) read(hash string) ([]byte, bool) {
+	objectPath, err := store.objectPath(hash)
+	if err != nil {
+		return nil, false
+	}
+
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, false
+	}
+
+	contents, err := ioutil.ReadAll(compressed)
+	if err != nil {
+		return nil, false
+	}
+
+	return contents, true
+}
+
+// Remove the copies that none of the files refer to anymore along with the
+// leftovers of interrupted writes
+func (store *pristineStore) prune(metadata *metaData) error {
+	referenced := make(map[string]bool)
+	for _, meta := range metadata.pathMap {
+		if meta.Hash == "" {
+			continue
+		}
+
+		objectPath, err := store.objectPath(meta.Hash)
+		if err == nil {
+			referenced[objectPath] = true
+		}
+	}
+
+	err := filepath.Walk(store.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || referenced[path] {
+			return nil
+		}
+
+		// Writes may still be in progress in another process
+		if strings.HasPrefix(info.Name(), pristineTempPrefix) && time.Since(info.ModTime()) < 24*time.Hour {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
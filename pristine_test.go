@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPristineStore(t *testing.T) {
+	sandbox, err := ioutil.TempDir("", "gojazz-pristine")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	md := newMetaData()
+	md.pristine = true
+	store := md.pristineStore(sandbox)
+
+	// Identical contents share a copy, stored with the repository line delimiters
+	hashes := []string{}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(sandbox, name)
+		err = ioutil.WriteFile(path, []byte("one\r\ntwo\r\n"), 0600)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		hash, err := hashLocalFile(path, EOL_CRLF)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = store.put(path, EOL_CRLF, hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		md.simplePut(metaObject{Path: path, Hash: hash}, sandbox)
+		hashes = append(hashes, hash)
+	}
+
+	if hashes[0] != hashes[1] {
+		t.Fatalf("Expected the same hash for the same contents")
+	}
+
+	contents, ok := store.read(hashes[0])
+	if !ok || string(contents) != "one\ntwo\n" {
+		t.Errorf("Unexpected pristine contents: %q", contents)
+	}
+
+	// Copies that no file refers to are pruned
+	delete(md.pathMap, "a.txt")
+	delete(md.pathMap, "b.txt")
+	err = store.prune(md)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, ok := store.read(hashes[0]); ok {
+		t.Errorf("Expected the unreferenced copy to be pruned")
+	}
+}
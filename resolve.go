@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func resolveDefaults() {
+	fmt.Printf("gojazz resolve [options] [paths...]\n")
+	flag.PrintDefaults()
+}
+
+// Mark the merge conflicts of the files at the paths as resolved so that they
+// are checked in again. Without paths the unresolved conflicts are listed.
+func resolveOp() {
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	mine := flag.Bool("mine", false, "Keep the version in the sandbox")
+	theirs := flag.Bool("theirs", false, "Replace the file with the version in the repository workspace")
+	flag.Usage = resolveDefaults
+	flag.Parse()
+
+	if *mine && *theirs {
+		panic(simpleWarning("Choose either -mine or -theirs."))
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if *sandboxPath == "" {
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+
+	metadataFile := filepath.Join(*sandboxPath, metadataFileName)
+	metadata := newMetaData()
+	err = metadata.load(metadataFile)
+	if err != nil {
+		panic(simpleWarning("Not a sandbox"))
+	}
+
+	conflicts := []string{}
+	for p, _ := range metadata.conflicts {
+		conflicts = append(conflicts, p)
+	}
+	sort.Strings(conflicts)
+
+	if flag.NArg() == 0 {
+		for _, rel := range conflicts {
+			emit(Event{Type: EVENT_CHANGE, Phase: "resolve", Path: filepath.ToSlash(rel), Change: "Conflict"})
+		}
+		if len(conflicts) == 0 {
+			emitMessage("No unresolved conflicts")
+		}
+		return
+	}
+
+	filters := sandboxPaths(*sandboxPath, cwd, flag.Args())
+	base := &baseReader{metadata: metadata, pristine: metadata.pristineStore(*sandboxPath)}
+
+	resolved := 0
+	for _, rel := range conflicts {
+		if !withinAny(rel, filters) {
+			continue
+		}
+
+		localPath := filepath.Join(*sandboxPath, rel)
+		meta := metadata.pathMap[rel]
+
+		switch {
+		case *theirs:
+			meta.Path = localPath
+			metadata.simplePut(restoreLoaded(base, *sandboxPath, rel, meta), *sandboxPath)
+		case *mine:
+		default:
+			// Files that couldn't be merged need a choice, merged files need
+			//  their markers removed
+			info, err := os.Lstat(localPath)
+			if err != nil {
+				panic(simpleWarning(rel + " is missing, use -theirs to get the version in the repository workspace."))
+			}
+
+			contents := readLocal(localPath, metadata.eolStyleFor(rel))
+			if isSymlink(info) || meta.LinkTarget != "" || isBinary(contents) {
+				panic(simpleWarning(rel + " can't be merged. Choose your version with -mine or the version in the repository workspace with -theirs."))
+			}
+			if hasConflictMarkers(contents) {
+				panic(simpleWarning(rel + " still has conflict markers. Edit the file or choose a version with -mine or -theirs."))
+			}
+		}
+
+		delete(metadata.conflicts, rel)
+		emit(Event{Type: EVENT_CHANGE, Phase: "resolve", Path: filepath.ToSlash(rel), Change: "Resolved"})
+		resolved++
+	}
+
+	if resolved == 0 {
+		panic(simpleWarning("There are no unresolved conflicts in those paths."))
+	}
+
+	err = metadata.save(metadataFile)
+	if err != nil {
+		panic(err)
+	}
+
+	emit(Event{Type: EVENT_SUMMARY, Phase: "resolve", Path: *sandboxPath, Files: resolved, Message: fmt.Sprintf("Resolved %v conflicts", resolved)})
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func revertDefaults() {
+	fmt.Printf("gojazz revert [options] <paths...>\n")
+	flag.PrintDefaults()
+}
+
+// Discard the local changes to the files and folders at the paths, including
+// everything inside of folders. Files go back to the versions that were loaded.
+func revertOp() {
+	sandboxPath := flag.String("sandbox", "", "Location of the sandbox")
+	dryRun := flag.Bool("dry-run", false, "Only show the changes that would be reverted")
+	transfer := transferFlags()
+	flag.Usage = revertDefaults
+	flag.Parse()
+	transfer.apply()
+
+	if flag.NArg() == 0 {
+		emitWarning("Provide the files or folders to revert and try again. Use . for the current folder.")
+		revertDefaults()
+		return
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if *sandboxPath == "" {
+		path := findSandbox(cwd)
+		sandboxPath = &path
+	}
+
+	filters := sandboxPaths(*sandboxPath, cwd, flag.Args())
+	reverted := revertPaths(*sandboxPath, filters, *dryRun)
+
+	message := fmt.Sprintf("Reverted %v changes", reverted)
+	if *dryRun {
+		message = fmt.Sprintf("Would revert %v changes", reverted)
+	}
+	if reverted == 0 {
+		message = "No local changes to revert"
+	}
+	emit(Event{Type: EVENT_SUMMARY, Phase: "revert", Path: *sandboxPath, Files: reverted, Message: message})
+}
+
+// Revert the changes within the filters and return how many there were. With
+// dryRun the changes are only reported.
+func revertPaths(sandboxPath string, filters []string, dryRun bool) int {
+	metadataFile := filepath.Join(sandboxPath, metadataFileName)
+
+	status, err := scmStatus(sandboxPath, NO_COPY)
+	if err != nil {
+		panic(err)
+	}
+
+	// Moved items go back to where they were loaded first, their other changes
+	//  are reverted there
+	reverted := 0
+	for _, to := range sortedKeys(status.Moved) {
+		from := status.Moved[to]
+		if !withinAny(to, filters) && !withinAny(from, filters) {
+			continue
+		}
+		filters = append(filters, from)
+
+		emit(Event{Type: EVENT_CHANGE, Phase: "revert", Path: to, From: from, Change: "Moved"})
+		reverted++
+		if dryRun {
+			continue
+		}
+
+		_, err = os.Lstat(filepath.Join(sandboxPath, from))
+		if err == nil {
+			panic(simpleWarning("Cannot move " + to + " back, there is something else at " + from + " now."))
+		}
+
+		err = os.MkdirAll(filepath.Dir(filepath.Join(sandboxPath, from)), 0700)
+		if err == nil {
+			err = os.Rename(filepath.Join(sandboxPath, to), filepath.Join(sandboxPath, from))
+		}
+		if err != nil {
+			panic(err)
+		}
+		status.metaData.recordMove(to, from)
+	}
+
+	if reverted > 0 && !dryRun {
+		err = status.metaData.save(metadataFile)
+		if err != nil {
+			panic(err)
+		}
+
+		status, err = scmStatus(sandboxPath, NO_COPY)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	metadata := status.metaData
+	base := &baseReader{metadata: metadata, pristine: metadata.pristineStore(sandboxPath)}
+
+	// Contents of added folders are removed before the folders
+	added := sortedPaths(status.Added, filters)
+	for i := len(added) - 1; i >= 0; i-- {
+		emit(Event{Type: EVENT_CHANGE, Phase: "revert", Path: added[i], Change: "Added"})
+		reverted++
+		if dryRun {
+			continue
+		}
+
+		// Folders that still have ignored files in them are kept
+		err = os.Remove(filepath.Join(sandboxPath, added[i]))
+		if err != nil && !os.IsNotExist(err) {
+			info, statErr := os.Lstat(filepath.Join(sandboxPath, added[i]))
+			if statErr != nil || !info.IsDir() {
+				panic(err)
+			}
+		}
+	}
+
+	// Deleted folders are restored before their contents
+	restore := make(map[string]bool)
+	for p, _ := range status.Modified {
+		restore[p] = true
+	}
+	for p, _ := range status.Deleted {
+		restore[p] = true
+	}
+
+	for _, rel := range sortedPaths(restore, filters) {
+		change := "Modified"
+		if status.Deleted[rel] {
+			change = "Deleted"
+		}
+
+		emit(Event{Type: EVENT_CHANGE, Phase: "revert", Path: rel, Change: change})
+		reverted++
+		if dryRun {
+			continue
+		}
+
+		meta, _ := metadata.get(filepath.Join(sandboxPath, rel), sandboxPath)
+		metadata.simplePut(restoreLoaded(base, sandboxPath, rel, meta), sandboxPath)
+		delete(metadata.conflicts, rel)
+	}
+
+	if !dryRun {
+		err = metadata.save(metadataFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return reverted
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedPaths(changes map[string]bool, filters []string) []string {
+	paths := []string{}
+	for p, _ := range changes {
+		if withinAny(p, filters) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Put the loaded version of the item back into the sandbox and return its new
+// metadata
+func restoreLoaded(base *baseReader, sandboxPath string, rel string, meta metaObject) metaObject {
+	localPath := filepath.Join(sandboxPath, rel)
+
+	err := os.RemoveAll(localPath)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(localPath), 0700)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if meta.LinkTarget != "" {
+		err = createLocalLink(sandboxPath, localPath, meta.LinkTarget)
+		if err != nil {
+			panic(err)
+		}
+		return meta
+	}
+
+	if meta.Hash == "" {
+		err = os.MkdirAll(localPath, 0700)
+		if err != nil {
+			panic(err)
+		}
+		return meta
+	}
+
+	contents := base.read(meta, rel)
+	eol := base.metadata.eolStyleFor(rel)
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		panic(err)
+	}
+	_, err = io.Copy(file, localizeEol(bytes.NewReader(contents), eol))
+	file.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	hash, err := hashLocalFile(localPath, eol)
+	if err != nil {
+		panic(err)
+	}
+	if base.pristine != nil {
+		keepPristine(base.pristine, localPath, eol, hash)
+	}
+
+	return downloadedMeta(localPath, ScmInfo{ComponentId: meta.ComponentId, ItemId: meta.ItemId, StateId: meta.StateId}, hash)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// A sandbox with a pristine store that was loaded with the files and folders
+func loadedSandbox(t *testing.T, files map[string]string, folders []string) string {
+	sandbox, err := ioutil.TempDir("", "gojazz-revert")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	md := newMetaData()
+	md.pristine = true
+	store := md.pristineStore(sandbox)
+
+	for _, rel := range folders {
+		path := filepath.Join(sandbox, rel)
+		err = os.MkdirAll(path, 0700)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		md.simplePut(metaObject{Path: path, ItemId: rel, ComponentId: "comp"}, sandbox)
+	}
+
+	for rel, contents := range files {
+		path := filepath.Join(sandbox, rel)
+		err = ioutil.WriteFile(path, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		hash, err := hashLocalFile(path, EOL_NONE)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = store.put(path, EOL_NONE, hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		md.simplePut(metaObject{Path: path, ItemId: rel, ComponentId: "comp", Hash: hash, Size: int64(len(contents))}, sandbox)
+	}
+
+	err = md.save(filepath.Join(sandbox, metadataFileName))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return sandbox
+}
+
+// The files and folders of the sandbox with the contents of the files
+func sandboxContents(t *testing.T, sandbox string) map[string]string {
+	contents := make(map[string]string)
+
+	err := filepath.Walk(sandbox, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(sandbox, path)
+		if rel == "." || rel == metadataFileName || isWithin(rel, pristineFolder) {
+			return nil
+		}
+
+		if info.IsDir() {
+			contents[rel] = "/"
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		contents[rel] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return contents
+}
+
+func TestRevert(t *testing.T) {
+	captured, restore := captureEvents()
+	defer restore()
+
+	files := map[string]string{
+		"main.txt":                         "loaded main\n",
+		"old.txt":                          "moved away\n",
+		filepath.Join("docs", "guide.txt"): "the guide\n",
+		filepath.Join("docs", "api", "index.txt"): "the api\n",
+	}
+	sandbox := loadedSandbox(t, files, []string{"docs", filepath.Join("docs", "api")})
+	defer os.RemoveAll(sandbox)
+
+	loaded := sandboxContents(t, sandbox)
+
+	// Modify, delete a whole folder, move a file and add files and folders,
+	//  one of them with an ignored file inside
+	err := ioutil.WriteFile(filepath.Join(sandbox, "main.txt"), []byte("changed main\n"), 0600)
+	if err == nil {
+		err = os.RemoveAll(filepath.Join(sandbox, "docs"))
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(sandbox, "moved"), 0700)
+	}
+	if err == nil {
+		err = os.Rename(filepath.Join(sandbox, "old.txt"), filepath.Join(sandbox, "moved", "old.txt"))
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(sandbox, "new", "deeper"), 0700)
+	}
+	for _, rel := range []string{filepath.Join("new", "new.txt"), filepath.Join("new", "deeper", "deep.txt"), filepath.Join("new", "app.exe"), "top.txt"} {
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(sandbox, rel), []byte(rel), 0600)
+		}
+	}
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	changed := sandboxContents(t, sandbox)
+
+	// A dry run only counts the changes
+	count := revertPaths(sandbox, []string{"."}, true)
+	if count == 0 {
+		t.Errorf("Expected changes to revert")
+	}
+	if after := sandboxContents(t, sandbox); !reflect.DeepEqual(after, changed) {
+		t.Errorf("A dry run should not touch the sandbox: %v", after)
+	}
+
+	captured.events = nil
+	reverted := revertPaths(sandbox, []string{"."}, false)
+	if reverted != count {
+		t.Errorf("The dry run found %v changes but %v were reverted", count, reverted)
+	}
+
+	// Everything is back as it was loaded, except for the folder with the
+	//  ignored file in it
+	expected := make(map[string]string)
+	for rel, contents := range loaded {
+		expected[rel] = contents
+	}
+	expected["new"] = "/"
+	expected[filepath.Join("new", "app.exe")] = filepath.Join("new", "app.exe")
+
+	after := sandboxContents(t, sandbox)
+	if !reflect.DeepEqual(after, expected) {
+		paths := []string{}
+		for rel, _ := range after {
+			paths = append(paths, rel)
+		}
+		sort.Strings(paths)
+		t.Errorf("Unexpected sandbox after the revert: %v %v", paths, after)
+	}
+
+	status, err := scmStatus(sandbox, NO_COPY)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(status.entries()) != 1 || !status.Added["new"] {
+		t.Errorf("Only the kept folder should be left as a change: %v", status)
+	}
+
+	// Moves go back first, added items are removed deepest first and deleted
+	//  folders are restored before their contents
+	order := []string{}
+	for _, e := range captured.events {
+		order = append(order, e.Path)
+	}
+	position := func(rel string) int {
+		for i, p := range order {
+			if p == rel {
+				return i
+			}
+		}
+		t.Errorf("%v was not reverted: %v", rel, order)
+		return -1
+	}
+	if position(filepath.Join("moved", "old.txt")) != 0 {
+		t.Errorf("The move should be reverted first: %v", order)
+	}
+	if !(position(filepath.Join("new", "deeper", "deep.txt")) < position(filepath.Join("new", "deeper")) && position(filepath.Join("new", "deeper")) < position("new")) {
+		t.Errorf("Added items should be removed deepest first: %v", order)
+	}
+	if !(position("docs") < position(filepath.Join("docs", "api")) && position(filepath.Join("docs", "api")) < position(filepath.Join("docs", "api", "index.txt"))) {
+		t.Errorf("Deleted folders should be restored before their contents: %v", order)
+	}
+}
+
+func TestRevertSelectedPaths(t *testing.T) {
+	_, restore := captureEvents()
+	defer restore()
+
+	sandbox := loadedSandbox(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"}, nil)
+	defer os.RemoveAll(sandbox)
+
+	for _, rel := range []string{"a.txt", "b.txt"} {
+		err := ioutil.WriteFile(filepath.Join(sandbox, rel), []byte("changed\n"), 0600)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if reverted := revertPaths(sandbox, []string{"a.txt"}, false); reverted != 1 {
+		t.Errorf("Only the selected file should be reverted: %v", reverted)
+	}
+
+	contents := sandboxContents(t, sandbox)
+	if contents["a.txt"] != "a\n" || contents["b.txt"] != "changed\n" {
+		t.Errorf("Unexpected contents after the revert: %v", contents)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 )
 
 const (
+	// Initial number of concurrent requests while walking
 	numWalkGoroutines = 10
 )
 
@@ -184,8 +186,11 @@ type soapreturnvalue struct {
 	Value soapvalue `json:"value"`
 }
 type soapvalue struct {
-	ItemId string     `json:"itemId"`
-	Items  []soapitem `json:"items"`
+	ItemId     string          `json:"itemId"`
+	Items      []soapitem      `json:"items"`
+	ChangeSets []soapchangeset `json:"changeSets"`
+	Conflicts  []soapconflict  `json:"conflicts"`
+	Gaps       []soapchangeset `json:"gaps"`
 }
 type soapitem struct {
 	Workspace soapworkspace `json:"workspace"`
@@ -194,77 +199,124 @@ type soapworkspace struct {
 	Name   string              `json:"name"`
 	Flows  []soapworkspaceflow `json:"flows"`
 	ItemId string              `json:"itemId"`
+	Owner  soapcontributor     `json:"owner"`
 }
 type soapworkspaceflow struct {
 	Flags           int           `json:"flags"`
 	TargetWorkspace soapworkspace `json:"targetWorkspace"`
 }
+type soapcontributor struct {
+	ItemId string `json:"itemId"`
+	Name   string `json:"name"`
+}
+type soapchangeset struct {
+	ItemId    string          `json:"itemId"`
+	Comment   string          `json:"comment"`
+	Active    bool            `json:"active"`
+	Current   bool            `json:"current"`
+	Component soapcomponent   `json:"component"`
+	Changes   []soapchangeref `json:"changes"`
+}
+type soapcomponent struct {
+	ItemId string `json:"itemId"`
+	Name   string `json:"name"`
+}
+type soapchangeref struct {
+	ItemId string `json:"itemId"`
+}
+type soapconflict struct {
+	Component soapcomponent `json:"component"`
+	Path      string        `json:"path"`
+}
 
-func FindWorkspaceForStream(client *Client, ccmBaseUrl string, streamId string) (string, error) {
-	contributorId, err := FindContributorId(client, ccmBaseUrl)
-	if err != nil {
-		return "", err
-	}
+// Find the repository workspaces matching the query. Useful query parameters
+// are ownerItemId, name and workspaceItemId.
+func FindWorkspaces(client *Client, ccmBaseUrl string, query url.Values) ([]soapworkspace, error) {
+	workspacesUrl := path.Join(ccmBaseUrl, "/service/com.ibm.team.scm.common.internal.rest.IScmRestService/workspaces") + "?" + query.Encode()
+	workspacesUrl = strings.Replace(workspacesUrl, ":/", "://", 1)
 
-	url := path.Join(ccmBaseUrl, "/service/com.ibm.team.scm.common.internal.rest.IScmRestService/workspaces?ownerItemId="+contributorId)
-	url = strings.Replace(url, ":/", "://", 1)
-
-	request, err := http.NewRequest("GET", url, nil)
+	request, err := http.NewRequest("GET", workspacesUrl, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	request.Header.Add("Accept", "text/json")
 
 	resp, err := client.Do(request)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", errorFromResponse(resp)
+		return nil, errorFromResponse(resp)
 	}
 
 	result := &soapenv{}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = json.Unmarshal(b, result)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	workspaces := []soapworkspace{}
 	for _, item := range result.Body.Response.ReturnValue.Value.Items {
-		for _, flow := range item.Workspace.Flows {
-			if flow.Flags&0x1 == 0x1 && flow.TargetWorkspace.ItemId == streamId {
-				return item.Workspace.ItemId, nil
-			}
+		workspaces = append(workspaces, item.Workspace)
+	}
+
+	return workspaces, nil
+}
+
+// The stream that the workspace delivers to by default, if any
+func (workspace soapworkspace) flowTarget() string {
+	for _, flow := range workspace.Flows {
+		if flow.Flags&0x1 == 0x1 {
+			return flow.TargetWorkspace.ItemId
 		}
 	}
 
-	return "", nil
+	return ""
 }
 
-func FindStream(client *Client, ccmBaseUrl, projectName, streamName string) (string, error) {
-	// Fetch all of the user's repository workspaces
+func FindWorkspaceForStream(client *Client, ccmBaseUrl string, streamId string) (string, error) {
+	contributorId, err := FindContributorId(client, ccmBaseUrl)
+	if err != nil {
+		return "", err
+	}
+
+	workspaces, err := FindWorkspaces(client, ccmBaseUrl, url.Values{"ownerItemId": {contributorId}})
+	if err != nil {
+		return "", err
+	}
 
+	for _, workspace := range workspaces {
+		if workspace.flowTarget() == streamId {
+			return workspace.ItemId, nil
+		}
+	}
+
+	return "", nil
+}
+
+func FindStreams(client *Client, ccmBaseUrl, projectName string) ([]FileInfo, error) {
 	url := path.Join(ccmBaseUrl, "/service/com.ibm.team.filesystem.service.jazzhub.IOrionFilesystem/pa", projectName)
 	url = strings.Replace(url, ":/", "://", 1)
 
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	resp, err := client.Do(request)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", errorFromResponse(resp)
+		return nil, errorFromResponse(resp)
 	}
 
 	// The filesystem service renders the list of streams as a directory.
@@ -272,15 +324,24 @@ func FindStream(client *Client, ccmBaseUrl, projectName, streamName string) (str
 	streamList := &FileInfo{}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = json.Unmarshal(b, streamList)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamList.Children, nil
+}
+
+func FindStream(client *Client, ccmBaseUrl, projectName, streamName string) (string, error) {
+	streams, err := FindStreams(client, ccmBaseUrl, projectName)
 	if err != nil {
 		return "", err
 	}
 
 	// Return the first stream that matches the name
-	for _, s := range streamList.Children {
+	for _, s := range streams {
 		if s.Name == streamName {
 			return s.ScmInfo.ItemId, nil
 		}
@@ -344,42 +405,54 @@ func FindComponents(client *Client, ccmBaseUrl string, workspaceId string) ([]Fi
 	return result, nil
 }
 
-//type CreateWorkspaceResult struct {
-//	WorkspaceId string `json:"workspaceId"`
-//}
-//
-//func CreateWorkspaceFromStream(client *Client, ccmBaseUrl string, projectName string, userName string, streamId string, name string) (string, error) {
-//	// TODO it is completely nonsensical that we have to provide the Orion workspace and userName to create a repository workspace
-//	url := path.Join(jazzHubBaseUrl, "/code/jazz/Workspace/_/file/", userName+"-OrionContent", projectName)
-//	url = strings.Replace(url, ":/", "://", 1)
-//
-//	fmt.Printf("URL: %v\n", url)
-//
-//	request, err := http.NewRequest("POST", url, strings.NewReader(`{
-//		"Create": true,
-//		"repoUrl": "`+ccmBaseUrl+`",
-//		"name": "`+name+`",
-//		"description": "Default Workspace",
-//		"streamId": "`+streamId+`"
-//	}`))
-//	if err != nil {
-//		return "", err
-//	}
-//	addOrionHeaders(request)
-//
-//	resp, err := client.Do(request)
-//	if err != nil {
-//		return "", err
-//	}
-//
-//	result := &CreateWorkspaceResult{}
-//	err = waitForOrionResponse(client, resp, result)
-//	if err != nil {
-//		return "", err
-//	}
-//
-//	return result.WorkspaceId, nil
-//}
+type CreateWorkspaceResult struct {
+	WorkspaceId string `json:"workspaceId"`
+}
+
+// Create a repository workspace with the name that flows with the provided stream
+func CreateWorkspaceFromStream(client *Client, ccmBaseUrl string, projectName string, streamId string, streamName string, name string) (string, error) {
+	if client.GetJazzId() == "" {
+		return "", errors.New("Not logged in")
+	}
+
+	// The repository workspace is created through the Orion workspace of the current user
+	url := path.Join(jazzHubBaseUrl, "/code/jazz/Workspace/_/file/", client.GetJazzId()+"-OrionContent", projectName)
+	url = strings.Replace(url, ":/", "://", 1)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"Create":      true,
+		"repoUrl":     ccmBaseUrl,
+		"name":        name,
+		"description": "Repository workspace for " + streamName,
+		"streamId":    streamId,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	addOrionHeaders(request)
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+
+	result := &CreateWorkspaceResult{}
+	err = waitForOrionResponse(client, resp, result)
+	if err != nil {
+		return "", err
+	}
+
+	if result.WorkspaceId == "" {
+		return "", &JazzError{Msg: "The repository workspace for stream " + streamName + " could not be created", Log: true}
+	}
+
+	return result.WorkspaceId, nil
+}
 
 type File struct {
 	client  *Client
@@ -390,10 +463,17 @@ type File struct {
 }
 
 type FileInfo struct {
-	Name      string
-	Directory bool
-	Children  []FileInfo
-	ScmInfo   ScmInfo `json:"RTCSCM"`
+	Name           string
+	Directory      bool
+	Children       []FileInfo
+	Attributes     FileAttributes
+	LinkTarget     string
+	LocalTimeStamp int64
+	ScmInfo        ScmInfo `json:"RTCSCM"`
+}
+
+type FileAttributes struct {
+	SymbolicLink bool
 }
 
 type ScmInfo struct {
@@ -589,6 +669,52 @@ func Mkdir(client *Client, ccmBaseUrl string, workspaceId string, componentId, p
 	return f, nil
 }
 
+func CreateSymlink(client *Client, ccmBaseUrl string, workspaceId string, componentId, p string, target string) (*File, error) {
+	f := &File{}
+	f.client = client
+	f.url = assembleOFSUrl(ccmBaseUrl, workspaceId, componentId, p)
+
+	parentPath := path.Dir(p)
+	fileName := path.Base(p)
+
+	createUrl := assembleOFSUrl(ccmBaseUrl, workspaceId, componentId, parentPath) + "?op=createSymbolicLink&name=" + url.QueryEscape(fileName) + "&target=" + url.QueryEscape(target)
+
+	request, err := http.NewRequest("POST", createUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		body := string(b)
+		// The service returns 500 instead of 404
+		if resp.StatusCode == 500 && strings.Contains(body, "Failed to resolve path:") {
+			return nil, &JazzError{Msg: fmt.Sprintf("Not Found: %v", p), StatusCode: 404}
+		}
+		return nil, errorFromResponse(resp)
+	}
+	info := &FileInfo{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, info)
+	if err != nil {
+		return nil, err
+	}
+
+	f.info = *info
+
+	return f, nil
+}
+
 func MkdirAll(client *Client, ccmBaseUrl string, workspaceId string, componentId, p string) (*File, error) {
 	// Walk up the tree to find the first directory that exists
 	p = path.Clean(p)
@@ -672,6 +798,302 @@ func Remove(client *Client, ccmBaseUrl string, workspaceId string, componentId s
 	return nil
 }
 
+// Move the file or folder to the destination path in the same component. The
+// item keeps its history.
+func Move(client *Client, ccmBaseUrl string, workspaceId string, componentId string, p string, destination string) (*File, error) {
+	f := &File{}
+	f.client = client
+	f.url = assembleOFSUrl(ccmBaseUrl, workspaceId, componentId, destination)
+
+	moveUrl := assembleOFSUrl(ccmBaseUrl, workspaceId, componentId, p) + "?op=move&destination=" + url.QueryEscape(destination)
+
+	request, err := http.NewRequest("POST", moveUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Workaround for weird IBM DOS bug with the OrionFilesystem
+	if strings.HasSuffix(assembleOFSUrl(ccmBaseUrl, workspaceId, componentId, p), ".jspderp") {
+		request.Header.Add("X-HasUriSuffix", "true")
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		body := string(b)
+		// The service returns 500 instead of 404
+		if resp.StatusCode == 500 && strings.Contains(body, "Failed to resolve path:") {
+			return nil, &JazzError{Msg: fmt.Sprintf("Not Found: %v", p), StatusCode: 404}
+		}
+		return nil, errorFromResponse(resp)
+	}
+
+	info := &FileInfo{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, info)
+	if err != nil {
+		return nil, err
+	}
+
+	f.info = *info
+
+	return f, nil
+}
+
+// Call a method of the SCM REST service with the parameters in the query for a
+// GET or in the form for a POST
+func scmRestCall(client *Client, ccmBaseUrl string, method string, name string, params url.Values) (*soapenv, error) {
+	serviceUrl := path.Join(ccmBaseUrl, "/service/com.ibm.team.scm.common.internal.rest.IScmRestService", name)
+	serviceUrl = strings.Replace(serviceUrl, ":/", "://", 1)
+
+	var request *http.Request
+	var err error
+	if method == "GET" {
+		request, err = http.NewRequest("GET", serviceUrl+"?"+params.Encode(), nil)
+	} else {
+		request, err = http.NewRequest(method, serviceUrl, strings.NewReader(params.Encode()))
+		if err == nil {
+			request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Accept", "text/json")
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errorFromResponse(resp)
+	}
+
+	result := &soapenv{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, result)
+	}
+
+	return result, err
+}
+
+// Create a repository workspace with the components at the baselines of the
+// snapshot, e.g. to read the files of the snapshot like any other configuration
+func CreateWorkspaceFromSnapshot(client *Client, ccmBaseUrl string, snapshotId string, name string) (string, error) {
+	params := url.Values{}
+	params.Set("name", name)
+	params.Set("snapshotItemId", snapshotId)
+
+	return createWorkspace(client, ccmBaseUrl, params)
+}
+
+// Create a repository workspace with the components of the baselines, at most
+// one baseline for each component
+func CreateWorkspaceFromBaselines(client *Client, ccmBaseUrl string, baselineIds []string, name string) (string, error) {
+	params := url.Values{}
+	params.Set("name", name)
+	params.Set("baselineItemIds", strings.Join(baselineIds, ","))
+
+	return createWorkspace(client, ccmBaseUrl, params)
+}
+
+func createWorkspace(client *Client, ccmBaseUrl string, params url.Values) (string, error) {
+	result, err := scmRestCall(client, ccmBaseUrl, "POST", "createWorkspace", params)
+	if err != nil {
+		return "", err
+	}
+
+	workspaceId := result.Body.Response.ReturnValue.Value.ItemId
+	if workspaceId == "" {
+		return "", &JazzError{Msg: "The repository workspace " + params.Get("name") + " could not be created", Log: true}
+	}
+
+	return workspaceId, nil
+}
+
+func DeleteWorkspace(client *Client, ccmBaseUrl string, workspaceId string) error {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+
+	_, err := scmRestCall(client, ccmBaseUrl, "POST", "deleteWorkspace", params)
+	return err
+}
+
+// Create a change set in the component of the repository workspace and make
+// it the current one, so that checkins go to it
+func CreateChangeSet(client *Client, ccmBaseUrl string, workspaceId string, componentId string, comment string) (string, error) {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	params.Set("componentItemId", componentId)
+	params.Set("comment", comment)
+	params.Set("setCurrent", "true")
+
+	result, err := scmRestCall(client, ccmBaseUrl, "POST", "createChangeSet", params)
+	if err != nil {
+		return "", err
+	}
+
+	changeSetId := result.Body.Response.ReturnValue.Value.ItemId
+	if changeSetId == "" {
+		return "", &JazzError{Msg: "The change set could not be created", Log: true}
+	}
+
+	return changeSetId, nil
+}
+
+// The change sets of the repository workspace that aren't in the stream yet,
+// or in its flow target when no stream is provided
+func FindOutgoingChangeSets(client *Client, ccmBaseUrl string, workspaceId string, streamId string) ([]soapchangeset, error) {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	if streamId != "" {
+		params.Set("targetItemId", streamId)
+	}
+	params.Set("outgoing", "true")
+
+	result, err := scmRestCall(client, ccmBaseUrl, "GET", "changeSets", params)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body.Response.ReturnValue.Value.ChangeSets, nil
+}
+
+// The change sets of the stream that aren't in the repository workspace yet
+func FindIncomingChangeSets(client *Client, ccmBaseUrl string, workspaceId string, streamId string) ([]soapchangeset, error) {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	params.Set("targetItemId", streamId)
+	params.Set("incoming", "true")
+
+	result, err := scmRestCall(client, ccmBaseUrl, "GET", "changeSets", params)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body.Response.ReturnValue.Value.ChangeSets, nil
+}
+
+// The stream that the repository workspace flows to by default
+func FindFlowTarget(client *Client, ccmBaseUrl string, workspaceId string) (soapworkspace, error) {
+	workspaces, err := FindWorkspaces(client, ccmBaseUrl, url.Values{"workspaceItemId": {workspaceId}})
+	if err != nil {
+		return soapworkspace{}, err
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.ItemId != workspaceId {
+			continue
+		}
+		for _, flow := range workspace.Flows {
+			if flow.Flags&0x1 == 0x1 {
+				return flow.TargetWorkspace, nil
+			}
+		}
+	}
+
+	return soapworkspace{}, nil
+}
+
+// Accept the change sets of the stream into the repository workspace. Nothing
+// is accepted when they conflict with the changes in the repository workspace
+// or when they depend on change sets that aren't accepted (gaps), these are
+// returned instead.
+func AcceptChangeSets(client *Client, ccmBaseUrl string, workspaceId string, streamId string, changeSetIds []string) ([]soapconflict, []soapchangeset, error) {
+	return flowChangeSets(client, ccmBaseUrl, "acceptChangeSets", workspaceId, streamId, changeSetIds)
+}
+
+// Deliver the change sets of the repository workspace to the stream, with the
+// same rules for conflicts and gaps as accepting them
+func DeliverChangeSets(client *Client, ccmBaseUrl string, workspaceId string, streamId string, changeSetIds []string) ([]soapconflict, []soapchangeset, error) {
+	return flowChangeSets(client, ccmBaseUrl, "deliverChangeSets", workspaceId, streamId, changeSetIds)
+}
+
+func flowChangeSets(client *Client, ccmBaseUrl string, name string, workspaceId string, streamId string, changeSetIds []string) ([]soapconflict, []soapchangeset, error) {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	params.Set("targetItemId", streamId)
+	params.Set("changeSetItemIds", strings.Join(changeSetIds, ","))
+	params.Set("failOnConflict", "true")
+	params.Set("failOnGap", "true")
+
+	result, err := scmRestCall(client, ccmBaseUrl, "POST", name, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value := result.Body.Response.ReturnValue.Value
+	return value.Conflicts, value.Gaps, nil
+}
+
+// Make the change set the one that checkins to its component go to
+func SetCurrentChangeSet(client *Client, ccmBaseUrl string, workspaceId string, componentId string, changeSetId string) error {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	params.Set("componentItemId", componentId)
+	params.Set("changeSetItemId", changeSetId)
+
+	_, err := scmRestCall(client, ccmBaseUrl, "POST", "currentChangeSet", params)
+	return err
+}
+
+// Complete the change set so that nothing else can be checked in to it
+func CompleteChangeSet(client *Client, ccmBaseUrl string, workspaceId string, changeSetId string) error {
+	params := url.Values{}
+	params.Set("workspaceItemId", workspaceId)
+	params.Set("changeSetItemIds", changeSetId)
+
+	_, err := scmRestCall(client, ccmBaseUrl, "POST", "closeChangeSets", params)
+	return err
+}
+
+func SetChangeSetComment(client *Client, ccmBaseUrl string, changeSetId string, comment string) error {
+	params := url.Values{}
+	params.Set("changeSetItemId", changeSetId)
+	params.Set("comment", comment)
+
+	_, err := scmRestCall(client, ccmBaseUrl, "POST", "changeSetComment", params)
+	return err
+}
+
+// Open the contents of a particular version of a file by its item and state
+// IDs. The version doesn't have to be in any workspace anymore.
+func OpenVersion(client *Client, ccmBaseUrl string, componentId string, itemId string, stateId string) (io.ReadCloser, error) {
+	versionUrl := path.Join(ccmBaseUrl, "/service/com.ibm.team.scm.common.internal.rest.IScmRestService/versionedContent", componentId, itemId, stateId)
+	versionUrl = strings.Replace(versionUrl, ":/", "://", 1)
+
+	request, err := http.NewRequest("GET", versionUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, errorFromResponse(resp)
+	}
+
+	return resp.Body, nil
+}
+
 func (f *File) Read(p []byte) (int, error) {
 	if f.reading == nil {
 		request, err := http.NewRequest("GET", f.url+"?op=readContent", nil)
@@ -705,11 +1127,57 @@ func (f *File) Read(p []byte) (int, error) {
 		f.reading = resp.Body
 	}
 
-	return f.reading.Read(p)
+	n, err := f.reading.Read(p)
+	limitBandwidth(n)
+
+	return n, err
 }
 
 func (f *File) Write(contents io.Reader) error {
-	request, err := http.NewRequest("POST", f.url+"?op=writeContent", contents)
+	request, err := http.NewRequest("POST", f.url+"?op=writeContent", &limitedReader{contents})
+	if err != nil {
+		return err
+	}
+
+	// Workaround for weird IBM DOS bug with the OrionFilesystem
+	if strings.HasSuffix(f.url, ".jspderp") {
+		request.Header.Add("X-HasUriSuffix", "true")
+	}
+
+	resp, err := f.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		body := string(b)
+		// The service returns 500 instead of 404
+		if resp.StatusCode == 500 && strings.Contains(body, "Failed to resolve path:") {
+			return &JazzError{Msg: fmt.Sprintf("Not Found: %v", f.url), StatusCode: 404}
+		}
+		return errorFromResponse(resp)
+	}
+
+	info := &FileInfo{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, info)
+	if err != nil {
+		return err
+	}
+
+	f.info = *info
+
+	return nil
+}
+
+// Point an existing symbolic link at a new target
+func (f *File) SetLinkTarget(target string) error {
+	request, err := http.NewRequest("POST", f.url+"?op=setLinkTarget&target="+url.QueryEscape(target), nil)
 	if err != nil {
 		return err
 	}
@@ -777,7 +1245,7 @@ type walkData struct {
 
 func Walk(client *Client, ccmBaseUrl string, workspaceId string, componentId string, metadata *metaData, wf WalkFunc) error {
 	// Walk doesn't callback for the component root
-	root, err := Open(client, ccmBaseUrl, workspaceId, componentId, "/")
+	root, err := openLimited(walkLimiter, client, ccmBaseUrl, workspaceId, componentId, "/")
 	if err != nil {
 		return err
 	}
@@ -792,6 +1260,9 @@ func Walk(client *Client, ccmBaseUrl string, workspaceId string, componentId str
 	workTracker := make(chan bool)
 	finished := make(chan bool)
 
+	// Enough helpers for the largest number of concurrent requests that the limiter allows
+	numHelpers := walkLimiter.workers()
+
 	var firstError error = nil
 	errMutex := &sync.Mutex{}
 
@@ -807,7 +1278,7 @@ func Walk(client *Client, ccmBaseUrl string, workspaceId string, componentId str
 
 				if work == 0 {
 					// Send everyone (calling goroutine plus all helpers) the signal that they are finished
-					for i := 0; i < numWalkGoroutines+1; i++ {
+					for i := 0; i < numHelpers+1; i++ {
 						finished <- true
 					}
 					return
@@ -816,7 +1287,7 @@ func Walk(client *Client, ccmBaseUrl string, workspaceId string, componentId str
 		}
 	}()
 
-	for i := 0; i < numWalkGoroutines; i++ {
+	for i := 0; i < numHelpers; i++ {
 		go func() {
 			for {
 				select {
@@ -887,7 +1358,7 @@ func Walk(client *Client, ccmBaseUrl string, workspaceId string, componentId str
 }
 
 func internalWalk(data walkData) error {
-	f, err := Open(data.client, data.ccmBaseUrl, data.workspaceId, data.componentId, data.path)
+	f, err := openLimited(walkLimiter, data.client, data.ccmBaseUrl, data.workspaceId, data.componentId, data.path)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,19 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// The inode and change time of the file
+func fileIdentity(info os.FileInfo) (uint64, int64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+
+	return uint64(st.Ino), int64(st.Ctimespec.Sec)*1e9 + int64(st.Ctimespec.Nsec)
+}
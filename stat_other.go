@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"os"
+)
+
+// The inode and change time aren't available on this platform, the modified
+// time and size have to do.
+func fileIdentity(info os.FileInfo) (uint64, int64) {
+	return 0, 0
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Remember the stat information of the local file along with its hash
+func (meta *metaObject) recordStat(info os.FileInfo) {
+	meta.LastModified = info.ModTime().Unix()
+	meta.Size = info.Size()
+	meta.ModTimeNano = info.ModTime().UnixNano()
+	meta.Inode, meta.ChangeTimeNano = fileIdentity(info)
+}
+
+// Check whether the file is the same as when its hash was recorded without
+// reading it. Files modified at or after the time the metadata was saved are
+// racy. They could have changed again within the granularity of the timestamps
+// so they must be hashed.
+func (meta metaObject) statMatches(info os.FileInfo, savedAt time.Time) bool {
+	if meta.ModTimeNano == 0 {
+		return false
+	}
+
+	if info.Size() != meta.Size || info.ModTime().UnixNano() != meta.ModTimeNano {
+		return false
+	}
+
+	inode, ctime := fileIdentity(info)
+	if inode != meta.Inode || ctime != meta.ChangeTimeNano {
+		return false
+	}
+
+	return info.ModTime().Before(savedAt)
+}
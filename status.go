@@ -3,12 +3,16 @@ package main
 import (
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
 )
 
 type mode int
@@ -20,6 +24,12 @@ const (
 	STAGE mode = iota
 	BACKUP
 	NO_COPY
+
+	// Hashing is mostly waiting on the disk, even with few CPUs
+	minHashers = 4
+
+	// Exit code of the status for scripts when there are local changes
+	exitDirty = 1
 )
 
 func statusDefaults() {
@@ -31,9 +41,18 @@ type status struct {
 	Added    map[string]bool
 	Modified map[string]bool
 	Deleted  map[string]bool
+	// Items moved in the sandbox, from the new path to the loaded one
+	Moved map[string]string
 
 	metaData *metaData
 
+	// The stat information of some unchanged files was updated in the metadata
+	refreshed bool
+
+	// The stat information of the files when they were copied, so that
+	//  changes made after the copy are still noticed
+	copied map[string]os.FileInfo
+
 	sandboxPath string
 	copyPath    string
 }
@@ -43,60 +62,153 @@ func newStatus(sandboxPath string, m mode) *status {
 	status.Added = make(map[string]bool)
 	status.Modified = make(map[string]bool)
 	status.Deleted = make(map[string]bool)
+	status.Moved = make(map[string]string)
+	status.copied = make(map[string]os.FileInfo)
 
 	status.sandboxPath = sandboxPath
 
 	if m == STAGE {
 		status.copyPath = filepath.Join(status.sandboxPath, stageFolder)
 	} else if m == BACKUP {
-		status.copyPath = filepath.Join(status.sandboxPath, backupFolder)
+		status.copyPath = filepath.Join(status.sandboxPath, backupFolder, newBackupId(sandboxPath, time.Now()), backupFilesFolder)
 	}
 
 	return status
 }
 
 func (status *status) unchanged() bool {
-	return len(status.Added) == 0 && len(status.Modified) == 0 && len(status.Deleted) == 0
+	return len(status.Added) == 0 && len(status.Modified) == 0 && len(status.Deleted) == 0 && len(status.Moved) == 0
 }
 
 func (status *status) String() string {
 	// TODO hit the server and find the current name of this workspace
 	//result := status.metaData.workspaceName + "\n"
 
-	result := ""
+	result := "Type: " + status.typeName() + "\n"
 
-	if status.metaData.isstream {
-		result = result + "Type: Stream\n"
-	} else {
-		result = result + "Type: Repository Workspace\n"
+	for _, entry := range status.entries() {
+		if entry.From != "" {
+			result = result + entry.From + " -> " + entry.Path + " (" + entry.changeText() + ")\n"
+		} else {
+			result = result + entry.Path + " (" + entry.changeText() + ")\n"
+		}
+	}
+
+	if status.unchanged() {
+		result = result + "No local changes\n"
 	}
 
-	nochanges := true
+	return result
+}
 
-	for k, _ := range status.Added {
-		result = result + k + " (Added)\n"
-		nochanges = false
+// A change in the status with the details of its item for tools. Added items
+// don't have a component or item ID yet.
+type statusEntry struct {
+	Path        string `json:"path"`
+	Change      string `json:"change"`
+	From        string `json:"from,omitempty"`
+	ComponentId string `json:"componentId,omitempty"`
+	ItemId      string `json:"itemId,omitempty"`
+	Size        int64  `json:"size"`
+	Conflict    bool   `json:"conflict,omitempty"`
+}
+
+func (entry statusEntry) changeText() string {
+	if entry.Conflict {
+		return entry.Change + ", Conflict"
 	}
+	return entry.Change
+}
 
-	for k, _ := range status.Modified {
-		result = result + k + " (Modified)\n"
-		nochanges = false
+type byEntryPath []statusEntry
+
+func (a byEntryPath) Len() int      { return len(a) }
+func (a byEntryPath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byEntryPath) Less(i, j int) bool {
+	if a[i].Path == a[j].Path {
+		return a[i].Change < a[j].Change
 	}
+	return a[i].Path < a[j].Path
+}
 
+// The changes sorted by their path, a moved and modified file has an entry for each
+func (status *status) entries() []statusEntry {
+	entries := []statusEntry{}
+
+	add := func(p string, change string, from string) {
+		entry := statusEntry{Path: filepath.ToSlash(p), Change: change}
+
+		meta, ok := status.metaData.pathMap[p]
+		if from != "" {
+			entry.From = filepath.ToSlash(from)
+			meta, ok = status.metaData.pathMap[from]
+		}
+		if ok {
+			entry.ComponentId = meta.ComponentId
+			entry.ItemId = meta.ItemId
+			entry.Size = meta.Size
+		}
+		entry.Conflict = status.metaData.conflicts[p]
+
+		// Items that are still in the sandbox have their current size
+		if change != "Deleted" {
+			info, err := os.Lstat(filepath.Join(status.sandboxPath, p))
+			if err == nil && !info.IsDir() {
+				entry.Size = info.Size()
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for k, _ := range status.Added {
+		add(k, "Added", "")
+	}
+	for k, _ := range status.Modified {
+		add(k, "Modified", status.Moved[k])
+	}
 	for k, _ := range status.Deleted {
-		result = result + k + " (Deleted)\n"
-		nochanges = false
+		add(k, "Deleted", "")
+	}
+	for k, v := range status.Moved {
+		add(k, "Moved", v)
 	}
 
-	if nochanges {
-		result = result + "No local changes\n"
+	sort.Sort(byEntryPath(entries))
+
+	return entries
+}
+
+func (status *status) typeName() string {
+	if status.metaData.isstream {
+		return "Stream"
+	} else if status.metaData.readonly {
+		return "Repository Workspace (read-only)"
 	}
 
-	return result
+	return "Repository Workspace"
+}
+
+// Emit an event for each change in the status followed by a summary
+func (status *status) emitChanges() {
+	emitMessage("Type: %v", status.typeName())
+
+	for _, entry := range status.entries() {
+		emit(Event{Type: EVENT_CHANGE, Phase: "status", Path: entry.Path, From: entry.From, Change: entry.changeText()})
+	}
+
+	summary := Event{Type: EVENT_SUMMARY, Phase: "status", Path: status.sandboxPath, Files: len(status.Added) + len(status.Modified) + len(status.Deleted) + len(status.Moved)}
+	if status.unchanged() {
+		summary.Message = "No local changes"
+	}
+	emit(summary)
 }
 
 func statusOp() {
 	sandboxPath := flag.String("sandbox", "", "Location of the sandbox to load the files")
+	porcelain := flag.Bool("porcelain", false, "One line for each change in a stable format for scripts. Exits with 1 when there are local changes.")
+	jsonFlag := flag.Bool("json", false, "Print the changes with the details of their items as a JSON document. Exits with 1 when there are local changes.")
+	remote := flag.Bool("remote", false, "Also show the incoming changes in the repository workspace or stream and the conflicts with local changes")
 	flag.Usage = statusDefaults
 	flag.Parse()
 
@@ -110,14 +222,97 @@ func statusOp() {
 		sandboxPath = &path
 	}
 
-	fmt.Printf("Status of %v...\n", *sandboxPath)
+	// Nothing else goes to standard output in the formats for tools
+	forTools := *porcelain || *jsonFlag
+	if forTools && jsonOutput() {
+		panic(simpleWarning("The -porcelain and -json options of status can't be used with -output=json, which already reports every change as an event."))
+	}
+	if forTools {
+		reserveStdout()
+	} else {
+		emit(Event{Type: EVENT_PHASE_STARTED, Phase: "status", Path: *sandboxPath, Message: fmt.Sprintf("Status of %v...", *sandboxPath)})
+	}
 	status, err := scmStatus(*sandboxPath, NO_COPY)
 
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("%v", status)
+	// Save the stat information so that the next status is faster
+	if status.refreshed {
+		err = status.metaData.save(filepath.Join(*sandboxPath, metadataFileName))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var components []componentStatus
+	var incoming []statusEntry
+	if *remote {
+		components, incoming = status.remoteChanges(sandboxClient(status.metaData))
+	}
+
+	switch {
+	case *jsonFlag:
+		report := statusReport{Sandbox: *sandboxPath, Type: status.typeName(), Clean: status.unchanged(), Changes: status.entries(), Components: components, Incoming: incoming}
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(b))
+	case *porcelain:
+		// Files with unresolved merge conflicts are U
+		for _, entry := range status.entries() {
+			code := porcelainCodes[entry.Change]
+			if entry.Conflict {
+				code = "U"
+			}
+			if entry.From != "" {
+				fmt.Printf("%v %v -> %v\n", code, entry.From, entry.Path)
+			} else {
+				fmt.Printf("%v %v\n", code, entry.Path)
+			}
+		}
+
+		// Incoming changes start with <, conflicts with !
+		for _, entry := range incoming {
+			prefix := "<"
+			if entry.Conflict {
+				prefix = "!"
+			}
+			if entry.From != "" {
+				fmt.Printf("%v%v %v -> %v\n", prefix, porcelainCodes[entry.Change], entry.From, entry.Path)
+			} else {
+				fmt.Printf("%v%v %v\n", prefix, porcelainCodes[entry.Change], entry.Path)
+			}
+		}
+	default:
+		status.emitChanges()
+		if *remote {
+			emitIncoming(components, incoming)
+		}
+	}
+
+	if forTools && !status.unchanged() {
+		os.Exit(exitDirty)
+	}
+}
+
+// The whole status for the -json option
+type statusReport struct {
+	Sandbox    string            `json:"sandbox"`
+	Type       string            `json:"type"`
+	Clean      bool              `json:"clean"`
+	Changes    []statusEntry     `json:"changes"`
+	Components []componentStatus `json:"components,omitempty"`
+	Incoming   []statusEntry     `json:"incoming,omitempty"`
+}
+
+var porcelainCodes = map[string]string{
+	"Added":    "A",
+	"Modified": "M",
+	"Deleted":  "D",
+	"Moved":    "R",
 }
 
 // Convenience call to scan the entire sandbox for changes.
@@ -138,6 +333,14 @@ func scmStatusSelectively(sandboxPath string, scanRoots *[]string, m mode) (*sta
 		return nil, simpleWarning("Not a sandbox")
 	}
 
+	// Backups of older versions become a set of their own before the new one
+	if m == BACKUP {
+		err = migrateLegacyBackup(sandboxPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	status := newStatus(sandboxPath, m)
 	status.metaData = oldMetaData
 
@@ -153,6 +356,16 @@ func scmStatusSelectively(sandboxPath string, scanRoots *[]string, m mode) (*sta
 		scanRoots = &[]string{sandboxPath}
 	}
 
+	ignores := newIgnorer(sandboxPath)
+
+	// Files modified after the metadata was saved can't be trusted by their stat information
+	savedAt := time.Now()
+	metaInfo, err := os.Stat(filepath.Join(sandboxPath, metadataFileName))
+	if err == nil {
+		savedAt = metaInfo.ModTime()
+	}
+	toHash := []hashJob{}
+
 	// Walk the current directory structure looking for changed items
 	for _, scanPath := range *scanRoots {
 		err = filepath.Walk(scanPath, func(path string, info os.FileInfo, err error) error {
@@ -166,7 +379,7 @@ func scmStatusSelectively(sandboxPath string, scanRoots *[]string, m mode) (*sta
 				return nil
 			}
 
-			ignored, err := IsIgnored(path)
+			ignored, err := ignores.ignored(path)
 			if err != nil {
 				return err
 			}
@@ -185,32 +398,40 @@ func scmStatusSelectively(sandboxPath string, scanRoots *[]string, m mode) (*sta
 				return nil
 			}
 
-			if !info.IsDir() {
-				// The modified time is not a good enough check to see if the
-				//  file is modified or not.
-				// Different sizes mean that the file has changed for sure
-				if meta.Size != info.Size() {
-					status.fileModified(meta, path, sandboxPath)
-				} else {
-					// Check the hashes
-					file, err := os.Open(path)
+			// Symbolic links are compared by their targets, never followed
+			if isSymlink(info) || meta.LinkTarget != "" {
+				modified := true
+				if meta.LinkTarget != "" {
+					modified, err = linkModified(meta, path, info)
 					if err != nil {
 						return err
 					}
-					defer file.Close()
-
-					hash := sha1.New()
-					_, err = io.Copy(hash, file)
+				}
 
-					if err != nil {
-						return err
-					}
+				if modified {
+					status.fileModified(meta, path, sandboxPath)
+				}
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 
-					newHash := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+			if !info.IsDir() {
+				rel, err := filepath.Rel(sandboxPath, path)
+				if err != nil {
+					return err
+				}
+				eol := oldMetaData.eolStyleFor(rel)
 
-					if meta.Hash != newHash {
-						status.fileModified(meta, path, sandboxPath)
-					}
+				// Different sizes mean that the file has changed for sure,
+				//  unless line delimiters are converted for this file.
+				// Files that look exactly like they did when they were
+				//  hashed don't need to be read again.
+				if eol == EOL_NONE && meta.Size != info.Size() {
+					status.fileModified(meta, path, sandboxPath)
+				} else if !meta.statMatches(info, savedAt) {
+					toHash = append(toHash, hashJob{meta: meta, path: path, eol: eol, info: info})
 				}
 			}
 
@@ -222,69 +443,128 @@ func scmStatusSelectively(sandboxPath string, scanRoots *[]string, m mode) (*sta
 		}
 	}
 
+	// Check the hashes of the normalized contents across a pool of workers
+	var hashErr error
+	for result := range hashFiles(toHash) {
+		if result.err != nil {
+			if hashErr == nil {
+				hashErr = result.err
+			}
+			continue
+		}
+
+		if result.hash != result.job.meta.Hash {
+			status.fileModified(result.job.meta, result.job.path, sandboxPath)
+			continue
+		}
+
+		// The contents are the same, remember the new stat information so
+		//  that the file isn't hashed again next time
+		refreshed := result.job.meta
+		refreshed.recordStat(result.job.info)
+		oldMetaData.simplePut(refreshed, sandboxPath)
+		status.refreshed = true
+	}
+	if hashErr != nil {
+		return nil, hashErr
+	}
+
 	// Walk the metadata to find any items that don't exist
 	for path, meta := range oldMetaData.pathMap {
 		fullpath := filepath.Join(sandboxPath, path)
-		_, err := os.Stat(fullpath)
+		_, err := os.Lstat(fullpath)
 		if err != nil {
 			status.fileDeleted(meta, fullpath, sandboxPath)
 		}
 	}
 
+	err = status.detectMoves()
+	if err != nil {
+		return nil, err
+	}
+
 	return status, nil
 }
 
-func (status *status) calcCopyPath(path string) string {
-	if status.copyPath == "" {
-		return ""
-	}
+type hashJob struct {
+	meta metaObject
+	path string
+	eol  eolStyle
+	info os.FileInfo
+}
 
-	relpath, err := filepath.Rel(status.sandboxPath, path)
+type hashResult struct {
+	job  hashJob
+	hash string
+	err  error
+}
 
-	if err != nil {
-		panic(err)
+// Hash the files in parallel. The results come back in no particular order.
+func hashFiles(jobs []hashJob) chan hashResult {
+	queue := make(chan hashJob)
+	results := make(chan hashResult)
+
+	numHashers := runtime.NumCPU()
+	if numHashers < minHashers {
+		numHashers = minHashers
 	}
 
-	return filepath.Join(status.copyPath, relpath)
-}
+	go func() {
+		for _, job := range jobs {
+			queue <- job
+		}
+		close(queue)
+	}()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numHashers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				hash, err := hashLocalFile(job.path, job.eol)
+				results <- hashResult{job: job, hash: hash, err: err}
+			}
+		}()
+	}
 
-func IsIgnored(path string) (bool, error) {
-	// Should we ignore changes to this file?
-	// Check for signs that it isn't source code
-	//  -Really big file (>10MB)
-	//  -File extension (e.g. .exe, .dll, .so)
-	//  -Temporary files left by editors (e.g. *~, *.ext.swp)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-	base := filepath.Base(path)
+	return results
+}
 
-	// Skip the metadata, staging and backup directories
-	if base == metadataFileName || strings.Contains(path, stageFolder) || strings.Contains(path, backupFolder) {
-		return true, nil
+// The SHA-1 hash of the normalized contents of the file
+func hashLocalFile(path string, eol eolStyle) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
+	defer file.Close()
 
-	// Skip bin directories
-	if strings.HasSuffix(path, "/bin") || strings.Contains(path, "/bin/") {
-		return true, nil
+	hash := sha1.New()
+	_, err = io.Copy(hash, normalizeEol(file, eol))
+	if err != nil {
+		return "", err
 	}
 
-	if strings.HasSuffix(base, ".exe") || strings.HasSuffix(base, ".dll") || strings.HasSuffix(base, ".so") {
-		return true, nil
-	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
 
-	if strings.HasSuffix(base, "~") || strings.HasSuffix(base, ".ext.swp") {
-		return true, nil
+func (status *status) calcCopyPath(path string) string {
+	if status.copyPath == "" {
+		return ""
 	}
 
-	s, err := os.Stat(path)
-	if err != nil {
-		return false, err
-	}
+	relpath, err := filepath.Rel(status.sandboxPath, path)
 
-	if s.Size() > 10*1024*1024 {
-		return true, nil
+	if err != nil {
+		panic(err)
 	}
 
-	return false, nil
+	return filepath.Join(status.copyPath, relpath)
 }
 
 func (status *status) fileAdded(path string, sandboxPath string) {
@@ -293,7 +573,7 @@ func (status *status) fileAdded(path string, sandboxPath string) {
 		panic(err)
 	}
 
-	s, err := os.Stat(path)
+	s, err := os.Lstat(path)
 	if err != nil {
 		panic(err)
 	}
@@ -302,7 +582,12 @@ func (status *status) fileAdded(path string, sandboxPath string) {
 	copyPath := status.calcCopyPath(path)
 
 	if copyPath != "" {
-		if s.IsDir() {
+		if isSymlink(s) {
+			err = copyLink(path, copyPath)
+			if err != nil {
+				panic(err)
+			}
+		} else if s.IsDir() {
 			os.MkdirAll(copyPath, 0700)
 		} else {
 			os.MkdirAll(filepath.Dir(copyPath), 0700)
@@ -318,6 +603,12 @@ func (status *status) fileAdded(path string, sandboxPath string) {
 			}
 			defer origFile.Close()
 
+			info, err := origFile.Stat()
+			if err != nil {
+				panic(err)
+			}
+			status.copied[rel] = info
+
 			_, err = io.Copy(stagedFile, origFile)
 			if err != nil {
 				panic(err)
@@ -336,13 +627,18 @@ func (status *status) fileModified(meta metaObject, path string, sandboxPath str
 	copyPath := status.calcCopyPath(path)
 
 	if copyPath != "" {
-		s, err := os.Stat(path)
+		s, err := os.Lstat(path)
 
 		if err != nil {
 			panic(err)
 		}
 
-		if s.IsDir() {
+		if isSymlink(s) {
+			err = copyLink(path, copyPath)
+			if err != nil {
+				panic(err)
+			}
+		} else if s.IsDir() {
 			os.MkdirAll(copyPath, 0700)
 		} else {
 			os.MkdirAll(filepath.Dir(copyPath), 0700)
@@ -358,6 +654,12 @@ func (status *status) fileModified(meta metaObject, path string, sandboxPath str
 			}
 			defer origFile.Close()
 
+			info, err := origFile.Stat()
+			if err != nil {
+				panic(err)
+			}
+			status.copied[rel] = info
+
 			_, err = io.Copy(stagedFile, origFile)
 			if err != nil {
 				panic(err)
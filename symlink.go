@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink == os.ModeSymlink
+}
+
+// Check that a symbolic link at linkPath with the given target resolves
+// to a location inside the sandbox.
+func linkInSandbox(sandboxPath string, linkPath string, target string) bool {
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+
+	resolved := filepath.Join(filepath.Dir(linkPath), filepath.FromSlash(target))
+	rel, err := filepath.Rel(sandboxPath, resolved)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Create a symbolic link in the sandbox that was loaded from the repository.
+// Links that point outside of the sandbox, or that can't be created on this
+// platform, are written as plain files containing the link target instead.
+func createLocalLink(sandboxPath string, localPath string, target string) error {
+	// Never write through an existing link or file
+	err := os.RemoveAll(localPath)
+	if err != nil {
+		return err
+	}
+
+	if linkInSandbox(sandboxPath, localPath, target) {
+		err = os.Symlink(filepath.FromSlash(target), localPath)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return ioutil.WriteFile(localPath, []byte(target), 0600)
+}
+
+// Check whether the item at the path still matches the symbolic link that was loaded.
+// The path can either be a link or the plain file fallback created during load.
+func linkModified(meta metaObject, path string, info os.FileInfo) (bool, error) {
+	if isSymlink(info) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false, err
+		}
+
+		return filepath.ToSlash(target) != meta.LinkTarget, nil
+	}
+
+	if info.IsDir() || info.Size() != int64(len(meta.LinkTarget)) {
+		return true, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return string(b) != meta.LinkTarget, nil
+}
+
+// Copy a symbolic link into the staging or backup area as a link.
+func copyLink(path string, copyPath string) error {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(copyPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(copyPath)
+	return os.Symlink(target, copyPath)
+}
+
+// Symbolic links that point outside of the sandbox are not checked in. They
+// would be meaningless, or worse, in someone else's sandbox.
+func checkinLinkAllowed(sandboxPath string, localPath string, stagePath string) bool {
+	target, err := os.Readlink(stagePath)
+	if err != nil {
+		panic(err)
+	}
+
+	if !linkInSandbox(sandboxPath, localPath, target) {
+		rel, _ := filepath.Rel(sandboxPath, localPath)
+		emitWarning("Cannot check-in symbolic link at path %v. Its target %v is outside of the sandbox.", rel, target)
+		return false
+	}
+
+	return true
+}
+
+// Check in a staged symbolic link to an existing remote link
+func checkinLink(stagePath string, remoteFile *File) metaObject {
+	target, err := os.Readlink(stagePath)
+	if err != nil {
+		panic(err)
+	}
+	target = filepath.ToSlash(target)
+
+	err = remoteFile.SetLinkTarget(target)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Remove(stagePath)
+
+	return linkMeta(remoteFile, target)
+}
+
+// Check in a staged symbolic link as a new remote link
+func checkinNewLink(client *Client, ccmBaseUrl string, workspaceId string, componentId string, remotePath string, stagePath string) metaObject {
+	target, err := os.Readlink(stagePath)
+	if err != nil {
+		panic(err)
+	}
+	target = filepath.ToSlash(target)
+
+	remoteFile, err := CreateSymlink(client, ccmBaseUrl, workspaceId, componentId, remotePath, target)
+	if err != nil {
+		// The parent directories may not be there yet, create them and try again
+		fileerror, ok := err.(*JazzError)
+		if !ok || fileerror.StatusCode != 404 {
+			panic(err)
+		}
+
+		_, err = MkdirAll(client, ccmBaseUrl, workspaceId, componentId, path.Dir(remotePath))
+		if err != nil {
+			panic(err)
+		}
+
+		remoteFile, err = CreateSymlink(client, ccmBaseUrl, workspaceId, componentId, remotePath, target)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	os.Remove(stagePath)
+
+	return linkMeta(remoteFile, target)
+}
+
+func linkMeta(remoteFile *File, target string) metaObject {
+	meta := metaObject{}
+	meta.ItemId = remoteFile.info.ScmInfo.ItemId
+	meta.StateId = remoteFile.info.ScmInfo.StateId
+	meta.ComponentId = remoteFile.info.ScmInfo.ComponentId
+	meta.LinkTarget = target
+
+	return meta
+}
@@ -15,8 +15,11 @@ func syncDefaults() {
 func syncOp() {
 	sandboxPath := flag.String("sandbox", "", "Location of the sandbox to sync the files")
 	force := flag.Bool("force", false, "Don't prompt for anything. Clobber files when necessary.")
+	component := flag.String("component", "", "Name or ID of the component for new top-level files and folders")
+	transfer := transferFlags()
 	flag.Usage = syncDefaults
 	flag.Parse()
+	transfer.apply()
 
 	if *sandboxPath == "" {
 		path, err := os.Getwd()
@@ -37,6 +40,10 @@ func syncOp() {
 		panic(simpleWarning("Sync is for repository workspaces, use load instead to incrementally update your loaded stream."))
 	}
 
+	if status.metaData.readonly {
+		panic(simpleWarning("Sync is for your own repository workspaces, use load instead to incrementally update this read-only sandbox."))
+	}
+
 	userId, password, err := getCredentials()
 	if err != nil {
 		panic(err)
@@ -47,18 +54,36 @@ func syncOp() {
 		panic(err)
 	}
 
-	doSyncOp(client, *sandboxPath, status, *force)
+	doSyncOp(client, *sandboxPath, status, *force, *component)
 }
 
-func doSyncOp(client *Client, sandboxPath string, status *status, force bool) {
-	scmCheckin(client, status, sandboxPath)
+func doSyncOp(client *Client, sandboxPath string, status *status, force bool, component string) {
+	conflicts := scmCheckin(client, status, sandboxPath, component)
+
+	// Files that changed on both sides are merged, the ones that merge cleanly
+	//  are checked in right away
+	if len(conflicts) > 0 {
+		clean := mergeConflicts(client, status, sandboxPath, conflicts)
+
+		var err error
+		status, err = scmStatus(sandboxPath, STAGE)
+		if err != nil {
+			panic(err)
+		}
+
+		if len(clean) > 0 {
+			status.restrict(&checkinSelection{paths: clean})
+			scmCheckin(client, status, sandboxPath, component)
+		}
+	}
 
 	// Clear out all of the changes in the status before performing the load
 	status.Added = make(map[string]bool)
 	status.Modified = make(map[string]bool)
 	status.Deleted = make(map[string]bool)
+	status.Moved = make(map[string]string)
 
-	scmLoad(client, status.metaData.ccmBaseUrl, status.metaData.projectName, status.metaData.workspaceId, status.metaData.isstream, status.metaData.userId, sandboxPath, status, force)
+	scmLoad(client, status.metaData.ccmBaseUrl, status.metaData.projectName, status.metaData.workspaceId, status.metaData.isstream, status.metaData.readonly, status.metaData.userId, sandboxPath, status, force, nil, nil)
 
 	// Force a load/reload of the jazzhub sandbox to avoid out of sync when
 	//  looking at the changes page
@@ -66,7 +91,6 @@ func doSyncOp(client *Client, sandboxPath string, status *status, force bool) {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println("Visit the following URL to work with your changes, deliver them to the rest of the team and more:")
 	redirect := fmt.Sprintf(jazzHubBaseUrl + "/code/jazzui/changes.html#" + "/code/jazz/Changes/_/file/" + client.GetJazzId() + "-OrionContent/" + status.metaData.projectName)
-	fmt.Printf("https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=%v\n", url.QueryEscape(redirect))
+	emit(Event{Type: EVENT_MESSAGE, Message: "Visit the following URL to work with your changes, deliver them to the rest of the team and more:", Url: "https://login.jazz.net/psso/proxy/jazzlogin?redirect_uri=" + url.QueryEscape(redirect)})
 }
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minConcurrency = 1
+	maxConcurrency = 64
+)
+
+var (
+	// Limits on the number of concurrent requests made while downloading, uploading and walking
+	downloadLimiter = newConcurrencyLimiter(numGoRoutines, true)
+	uploadLimiter   = newConcurrencyLimiter(numGoRoutines, true)
+	walkLimiter     = newConcurrencyLimiter(numWalkGoroutines, true)
+
+	// Global limit on the bandwidth used for file contents, nil means unlimited
+	bandwidth *bandwidthLimiter
+)
+
+// Options for tuning how files are transferred
+type transferOptions struct {
+	limitRate       *string
+	concurrency     *string
+	walkConcurrency *string
+	cache           *bool
+	cacheSize       *string
+}
+
+func transferFlags() *transferOptions {
+	options := &transferOptions{}
+
+	options.limitRate = flag.String("limit-rate", "", "Limit the bandwidth used for file transfers in bytes per second (e.g. 500K, 2M)")
+	options.concurrency = flag.String("concurrency", "auto", "Number of concurrent file downloads and uploads, 'auto' adapts to the server's latency and errors")
+	options.walkConcurrency = flag.String("walk-concurrency", "auto", "Number of concurrent requests for walking the remote folders, 'auto' adapts to the server's latency and errors")
+	options.cache = flag.Bool("cache", false, "Share the contents of downloaded files with your other sandboxes through a cache in ~/.gojazz/cache")
+	options.cacheSize = flag.String("cache-size", defaultCacheSize, "Evict the least recently used files when the cache grows beyond this size (e.g. 500M, 2G)")
+
+	return options
+}
+
+// Apply the transfer options once the flags are parsed
+func (options *transferOptions) apply() {
+	downloadLimiter = parseConcurrency(*options.concurrency, numGoRoutines)
+	uploadLimiter = parseConcurrency(*options.concurrency, numGoRoutines)
+	walkLimiter = parseConcurrency(*options.walkConcurrency, numWalkGoroutines)
+
+	bandwidth = nil
+	if *options.limitRate != "" {
+		rate, err := parseRate(*options.limitRate)
+		if err != nil {
+			panic(err)
+		}
+		bandwidth = newBandwidthLimiter(rate)
+	}
+
+	objects = nil
+	if *options.cache {
+		size, err := parseSize(*options.cacheSize)
+		if err != nil {
+			panic(err)
+		}
+		objects, err = openObjectCache(size)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func parseConcurrency(value string, initial int) *concurrencyLimiter {
+	if value == "" || value == "auto" {
+		return newConcurrencyLimiter(initial, true)
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minConcurrency || n > maxConcurrency {
+		panic(simpleWarning("Concurrency must be 'auto' or a number between " + strconv.Itoa(minConcurrency) + " and " + strconv.Itoa(maxConcurrency)))
+	}
+
+	return newConcurrencyLimiter(n, false)
+}
+
+// Parse a rate in bytes per second with an optional K, M or G suffix
+func parseRate(value string) (int64, error) {
+	rate, err := parseSize(value)
+	if err != nil || rate <= 0 {
+		return 0, simpleWarning("Invalid rate '" + value + "'. Use a number of bytes per second such as 500K or 2M.")
+	}
+
+	return rate, nil
+}
+
+// Parse a number of bytes with an optional K, M or G suffix
+func parseSize(value string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	trimmed = strings.TrimSuffix(trimmed, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(trimmed, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(trimmed, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(trimmed, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+
+	size, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || size < 0 {
+		return 0, simpleWarning("Invalid size '" + value + "'. Use a number of bytes such as 500M or 2G.")
+	}
+
+	return int64(size * float64(multiplier)), nil
+}
+
+// Limits the number of requests in flight. An adaptive limiter grows the limit
+// while the server keeps up and cuts it in half when the latency spikes or
+// requests fail (e.g. when the server starts throttling).
+type concurrencyLimiter struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	adaptive bool
+
+	successes   int
+	latency     time.Duration
+	baseline    time.Duration
+	lastBackoff time.Time
+}
+
+func newConcurrencyLimiter(limit int, adaptive bool) *concurrencyLimiter {
+	limiter := &concurrencyLimiter{limit: limit, adaptive: adaptive}
+	limiter.cond = sync.NewCond(&limiter.mutex)
+
+	return limiter
+}
+
+// The number of workers to start so that the limit can grow
+func (limiter *concurrencyLimiter) workers() int {
+	if limiter.adaptive {
+		return maxConcurrency
+	}
+
+	return limiter.limit
+}
+
+func (limiter *concurrencyLimiter) acquire() {
+	limiter.mutex.Lock()
+	for limiter.active >= limiter.limit {
+		limiter.cond.Wait()
+	}
+	limiter.active++
+	limiter.mutex.Unlock()
+}
+
+// Release a request reporting its latency and whether it failed. A zero
+// latency is not used to adapt the limit (e.g. for transfers of file contents
+// where the time depends on the size).
+func (limiter *concurrencyLimiter) release(latency time.Duration, err error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.active--
+	defer limiter.cond.Broadcast()
+
+	if !limiter.adaptive || (latency == 0 && err == nil) {
+		return
+	}
+
+	// Moving average of the latency, the lowest average is the baseline
+	if latency > 0 {
+		if limiter.latency == 0 {
+			limiter.latency = latency
+		} else {
+			limiter.latency = (limiter.latency*7 + latency) / 8
+		}
+		if limiter.baseline == 0 || limiter.latency < limiter.baseline {
+			limiter.baseline = limiter.latency
+		}
+	}
+
+	congested := err != nil || limiter.latency > 3*limiter.baseline
+	if congested {
+		// Back off at most once per second so that a burst of failures doesn't
+		//  collapse the limit all the way
+		if time.Since(limiter.lastBackoff) > time.Second {
+			limiter.limit = limiter.limit / 2
+			if limiter.limit < minConcurrency {
+				limiter.limit = minConcurrency
+			}
+			limiter.successes = 0
+			limiter.lastBackoff = time.Now()
+
+			// Start measuring again, accepting that the server may simply be slower now
+			limiter.baseline = (limiter.baseline*3 + limiter.latency) / 4
+			limiter.latency = 0
+		}
+		return
+	}
+
+	limiter.successes++
+	if limiter.successes >= limiter.limit && limiter.limit < maxConcurrency {
+		limiter.limit++
+		limiter.successes = 0
+	}
+}
+
+// Open a remote file or folder under the limiter, retrying with a backoff when
+// the server has trouble keeping up.
+func openLimited(limiter *concurrencyLimiter, client *Client, ccmBaseUrl string, workspaceId string, componentId string, p string) (*File, error) {
+	var f *File
+	var err error
+
+	for attempt := 0; attempt < 4; attempt++ {
+		if attempt > 0 {
+			<-time.After(time.Duration(attempt*attempt*100) * time.Millisecond)
+		}
+
+		limiter.acquire()
+		started := time.Now()
+		f, err = Open(client, ccmBaseUrl, workspaceId, componentId, p)
+
+		// Errors like not found or bad credentials are answers, not signs of trouble
+		if err == nil || !retryable(err) {
+			limiter.release(time.Since(started), nil)
+			break
+		}
+
+		limiter.release(time.Since(started), err)
+	}
+
+	return f, err
+}
+
+// Failures that can go away when the request is tried again later: network
+// errors, too many requests and server errors
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *JazzError:
+		return e.StatusCode == 429 || e.StatusCode > 499
+	case net.Error:
+		return true
+	}
+
+	return false
+}
+
+// Token bucket that limits the rate of bytes transferred
+type bandwidthLimiter struct {
+	mutex     sync.Mutex
+	rate      int64
+	available float64
+	last      time.Time
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	return &bandwidthLimiter{rate: rate, last: time.Now()}
+}
+
+// Account for n bytes, sleeping long enough to stay below the rate
+func (limiter *bandwidthLimiter) wait(n int) {
+	limiter.mutex.Lock()
+
+	now := time.Now()
+	limiter.available += now.Sub(limiter.last).Seconds() * float64(limiter.rate)
+	limiter.last = now
+
+	// Allow bursts of up to one second worth of transfer
+	if limiter.available > float64(limiter.rate) {
+		limiter.available = float64(limiter.rate)
+	}
+
+	limiter.available -= float64(n)
+	deficit := -limiter.available
+
+	limiter.mutex.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / float64(limiter.rate) * float64(time.Second)))
+	}
+}
+
+func limitBandwidth(n int) {
+	if bandwidth != nil && n > 0 {
+		bandwidth.wait(n)
+	}
+}
+
+// Reader that is subject to the global bandwidth limit
+type limitedReader struct {
+	r io.Reader
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	limitBandwidth(n)
+
+	return n, err
+}
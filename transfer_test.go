@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	transport := &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection reset")}
+	if !retryable(transport) {
+		t.Errorf("Network errors should be retried")
+	}
+
+	for _, code := range []int{429, 500, 503} {
+		if !retryable(&JazzError{StatusCode: code}) {
+			t.Errorf("Status %v should be retried", code)
+		}
+	}
+	for _, code := range []int{400, 401, 403, 404} {
+		if retryable(&JazzError{StatusCode: code}) {
+			t.Errorf("Status %v should not be retried", code)
+		}
+	}
+
+	if retryable(errors.New("unexpected response")) {
+		t.Errorf("Other errors should not be retried")
+	}
+}
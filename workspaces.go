@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// A repository workspace that flows to one of the streams of a project
+type workspaceCandidate struct {
+	workspace  soapworkspace
+	streamName string
+	owned      bool
+}
+
+// Find the repository workspaces matching the query that flow to one of the project's streams
+func findProjectWorkspaces(client *Client, ccmBaseUrl string, projectName string, query url.Values) ([]workspaceCandidate, error) {
+	contributorId, err := FindContributorId(client, ccmBaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := FindStreams(client, ccmBaseUrl, projectName)
+	if err != nil {
+		return nil, err
+	}
+	streamNames := make(map[string]string)
+	for _, stream := range streams {
+		streamNames[stream.ScmInfo.ItemId] = stream.Name
+	}
+
+	workspaces, err := FindWorkspaces(client, ccmBaseUrl, query)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []workspaceCandidate{}
+	for _, workspace := range workspaces {
+		streamName, ok := streamNames[workspace.flowTarget()]
+		if !ok {
+			continue
+		}
+
+		candidates = append(candidates, workspaceCandidate{workspace: workspace, streamName: streamName, owned: workspace.Owner.ItemId == contributorId})
+	}
+
+	return candidates, nil
+}
+
+func printWorkspaces(candidates []workspaceCandidate) {
+	for _, candidate := range candidates {
+		owner := ""
+		if !candidate.owned {
+			owner = fmt.Sprintf(", owned by %v (read-only)", candidate.workspace.Owner.Name)
+		}
+		emitMessage("  %v [%v] flows to %v%v", candidate.workspace.Name, candidate.workspace.ItemId, candidate.streamName, owner)
+	}
+}
+
+// The workspaces that a name refers to, the current user's own workspaces
+// come before the ones of colleagues
+func preferOwned(candidates []workspaceCandidate) []workspaceCandidate {
+	owned := []workspaceCandidate{}
+	for _, candidate := range candidates {
+		if candidate.owned {
+			owned = append(owned, candidate)
+		}
+	}
+
+	if len(owned) > 0 {
+		return owned
+	}
+	return candidates
+}
+
+// Print the repository workspaces of the project, the current user's first.
+// Workspaces of colleagues can be loaded read-only.
+func listWorkspaces(client *Client, ccmBaseUrl string, projectName string) {
+	candidates, err := findProjectWorkspaces(client, ccmBaseUrl, projectName, url.Values{})
+	if err != nil {
+		panic(err)
+	}
+
+	if len(candidates) == 0 {
+		emitMessage("There are no repository workspaces for this project.")
+		return
+	}
+
+	sort.Stable(byOwned(candidates))
+
+	emitMessage("Repository workspaces for this project:")
+	printWorkspaces(candidates)
+}
+
+type byOwned []workspaceCandidate
+
+func (c byOwned) Len() int           { return len(c) }
+func (c byOwned) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byOwned) Less(i, j int) bool { return c[i].owned && !c[j].owned }
+
+// Find a repository workspace by name. The current user's workspaces are preferred,
+// otherwise the name must match exactly one workspace of the project. Workspaces
+// that are owned by someone else are read-only.
+func findNamedWorkspace(client *Client, ccmBaseUrl string, projectName string, name string) (string, bool) {
+	candidates, err := findProjectWorkspaces(client, ccmBaseUrl, projectName, url.Values{"name": {name}})
+	if err != nil {
+		panic(err)
+	}
+	candidates = preferOwned(candidates)
+
+	if len(candidates) == 0 {
+		// The user's own workspace may flow to a stream of another project
+		workspaceId, err := FindRepositoryWorkspace(client, ccmBaseUrl, name)
+		if err != nil {
+			panic(err)
+		}
+		if workspaceId != "" {
+			return workspaceId, false
+		}
+
+		listWorkspaces(client, ccmBaseUrl, projectName)
+		panic(simpleWarning("Repository workspace with name " + name + " not found"))
+	}
+
+	if len(candidates) > 1 {
+		emitMessage("There is more than one repository workspace with the name %v:", name)
+		printWorkspaces(candidates)
+		panic(simpleWarning("Use the -workspace-id option to choose one of them."))
+	}
+
+	return candidates[0].workspace.ItemId, !candidates[0].owned
+}
+
+// Find a repository workspace by its item ID. Workspaces that are owned by
+// someone else are read-only.
+func findWorkspaceById(client *Client, ccmBaseUrl string, workspaceId string) (string, bool) {
+	contributorId, err := FindContributorId(client, ccmBaseUrl)
+	if err != nil {
+		panic(err)
+	}
+
+	workspaces, err := FindWorkspaces(client, ccmBaseUrl, url.Values{"workspaceItemId": {workspaceId}})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.ItemId == workspaceId {
+			return workspace.ItemId, workspace.Owner.ItemId != contributorId
+		}
+	}
+
+	panic(simpleWarning("Repository workspace with ID " + workspaceId + " not found"))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPreferOwnedWorkspaces(t *testing.T) {
+	mine := workspaceCandidate{workspace: soapworkspace{ItemId: "_mine", Name: "Feature X"}, owned: true}
+	colleague := workspaceCandidate{workspace: soapworkspace{ItemId: "_theirs", Name: "Feature X"}}
+	other := workspaceCandidate{workspace: soapworkspace{ItemId: "_other", Name: "Feature X"}}
+
+	preferred := preferOwned([]workspaceCandidate{colleague, mine})
+	if len(preferred) != 1 || preferred[0].workspace.ItemId != "_mine" {
+		t.Errorf("The user's own workspace should be preferred: %v", preferred)
+	}
+
+	preferred = preferOwned([]workspaceCandidate{colleague})
+	if len(preferred) != 1 || preferred[0].workspace.ItemId != "_theirs" {
+		t.Errorf("A colleague's workspace should be found when the user has none: %v", preferred)
+	}
+
+	preferred = preferOwned([]workspaceCandidate{colleague, other})
+	if len(preferred) != 2 {
+		t.Errorf("Workspaces of several colleagues should stay ambiguous: %v", preferred)
+	}
+
+	if preferred = preferOwned(nil); len(preferred) != 0 {
+		t.Errorf("No workspaces should be found: %v", preferred)
+	}
+}